@@ -23,26 +23,164 @@ import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:shortName=crp
 // +kubebuilder:metadata:annotations=api-approved.kubernetes.io=unapproved
+// +kubebuilder:printcolumn:name="Accepted",type=string,JSONPath=`.status.conditions[?(@.type=="Accepted")].status`
+// +kubebuilder:printcolumn:name="Programmed",type=string,JSONPath=`.status.conditions[?(@.type=="Programmed")].status`
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
-// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
 
 // ClusterReferencePattern identifies a common form of referencing pattern. This
 // can then be used with ReferenceGrants to selectively allow references.
+//
+// +kubebuilder:validation:XValidation:message="at least one of path or paths must be set",rule="has(self.path) || (has(self.paths) && size(self.paths) > 0)"
 type ClusterReferencePattern struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	// Group is the group of the referent.
+	//
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:XValidation:message="group must be empty or a lowercase DNS subdomain",rule="self == '' || self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?([.][a-z0-9]([-a-z0-9]*[a-z0-9])?)*$')"
 	Group string `json:"group"`
 
 	// Resource is the resource of the referent.
+	//
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:XValidation:message="resource must be a lowercase plural resource name, not a kind",rule="self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$')"
 	Resource string `json:"resource"`
 
 	// Version is the API version of this resource this path applies to.
-	Version string `json:"version,omitempty"`
+	//
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Version string `json:"version"`
 
-	// Path is the path which this reference may come from.
-	Path string `json:"path"`
+	// Path is the path which this reference may come from. This is
+	// equivalent to a single entry in Paths without any targets.
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=1024
+	// +kubebuilder:validation:XValidation:message="path must start with '.'",rule="self.startsWith('.')"
+	Path string `json:"path,omitempty"`
+
+	// Paths lists the paths which references may come from. References found
+	// through all paths, including Path, are combined.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=16
+	Paths []ReferencePath `json:"paths,omitempty"`
+
+	// Verbs are the verbs consumers are granted on referenced resources.
+	// Defaults to get, list and watch. The controller only accepts patterns
+	// whose verbs are within its configured set of allowed verbs.
+	//
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=5
+	Verbs []ReferenceVerb `json:"verbs,omitempty"`
+
+	// ClusterScopedReferrers describes how references from cluster-scoped
+	// referrers are handled. Defaults to RequireNamespace.
+	//
+	// +optional
+	// +kubebuilder:default=RequireNamespace
+	ClusterScopedReferrers ClusterScopedReferrerPolicy `json:"clusterScopedReferrers,omitempty"`
+
+	// Status describes the current state of the ClusterReferencePattern.
+	//
+	// +optional
+	Status ClusterReferencePatternStatus `json:"status,omitempty"`
+}
+
+// ClusterScopedReferrerPolicy describes how references from cluster-scoped
+// referrers are handled.
+//
+// +kubebuilder:validation:Enum=RequireNamespace;Ignore
+type ClusterScopedReferrerPolicy string
+
+const (
+	// ClusterScopedReferrerRequireNamespace requires references from
+	// cluster-scoped referrers to namespaced resources to specify a
+	// namespace, since there is no referrer namespace to default to. Such
+	// references are authorized by ReferenceGrants with a clusterScoped
+	// source.
+	ClusterScopedReferrerRequireNamespace ClusterScopedReferrerPolicy = "RequireNamespace"
+
+	// ClusterScopedReferrerIgnore ignores all references from cluster-scoped
+	// referrers.
+	ClusterScopedReferrerIgnore ClusterScopedReferrerPolicy = "Ignore"
+)
+
+// ReferenceVerb is a verb that may be granted on referenced resources.
+//
+// +kubebuilder:validation:Enum=get;list;watch;update;patch
+type ReferenceVerb string
+
+// Verbs that may be granted on referenced resources.
+const (
+	ReferenceVerbGet    ReferenceVerb = "get"
+	ReferenceVerbList   ReferenceVerb = "list"
+	ReferenceVerbWatch  ReferenceVerb = "watch"
+	ReferenceVerbUpdate ReferenceVerb = "update"
+	ReferenceVerbPatch  ReferenceVerb = "patch"
+)
+
+// ReferencePath describes a path which references may come from. Exactly one
+// of Path or Expression must be set.
+//
+// +kubebuilder:validation:XValidation:message="exactly one of path or expression must be set",rule="has(self.path) != has(self.expression)"
+type ReferencePath struct {
+	// Path is a JSONPath expression evaluated against each referrer. Every
+	// match is expected to be an object with group, resource or kind, name
+	// and optionally namespace fields.
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=1024
+	// +kubebuilder:validation:XValidation:message="path must start with '.'",rule="self.startsWith('.')"
+	Path string `json:"path,omitempty"`
+
+	// Expression is a CEL expression evaluated against each referrer, which
+	// is available as the `object` variable. It must return a list of maps
+	// with group, resource or kind, name and optionally namespace keys. This
+	// allows references that depend on other fields, for example:
+	//
+	//   object.spec.listeners.filter(l, l.protocol == 'HTTPS').map(l, l.tls.certificateRefs.map(r,
+	//     {'group': '', 'kind': 'Secret', 'name': r.name}))
+	//
+	// Nested lists are flattened. Fields named after reserved words, such as
+	// namespace, must be accessed with index syntax, for example
+	// r['namespace'].
+	//
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=4096
+	Expression string `json:"expression,omitempty"`
+
+	// Targets restricts the resources references found through this path may
+	// point to. When unspecified or empty, references to any resource are
+	// allowed.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=16
+	Targets []ReferenceTarget `json:"targets,omitempty"`
+}
+
+// ReferenceTarget describes a resource that references may point to.
+type ReferenceTarget struct {
+	// Group is the group of the target.
+	//
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:XValidation:message="group must be empty or a lowercase DNS subdomain",rule="self == '' || self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?([.][a-z0-9]([-a-z0-9]*[a-z0-9])?)*$')"
+	Group string `json:"group"`
+
+	// Resource is the resource of the target.
+	//
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:XValidation:message="resource must be a lowercase plural resource name, not a kind",rule="self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$')"
+	Resource string `json:"resource"`
 }
 
 // +kubebuilder:object:root=true
@@ -53,3 +191,97 @@ type ClusterReferencePatternList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []ClusterReferencePattern `json:"items"`
 }
+
+// ClusterReferencePatternStatus describes the current state of a ClusterReferencePattern.
+type ClusterReferencePatternStatus struct {
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	//
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// UnresolvedReferences lists references whose kind could not be mapped to
+	// a resource. No access is granted for them. The list is limited to 32
+	// entries, UnresolvedReferenceCount holds the total number of unresolved
+	// references.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	UnresolvedReferences []UnresolvedReference `json:"unresolvedReferences,omitempty"`
+
+	// UnresolvedReferenceCount is the total number of references whose kind
+	// could not be mapped to a resource.
+	//
+	// +optional
+	UnresolvedReferenceCount int32 `json:"unresolvedReferenceCount,omitempty"`
+
+	// MalformedReferences lists matches of the paths that are not valid
+	// references, for example because a required field is missing. The list
+	// is limited to 32 entries, MalformedReferenceCount holds the total
+	// number of malformed references.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	MalformedReferences []MalformedReference `json:"malformedReferences,omitempty"`
+
+	// MalformedReferenceCount is the total number of matches of the paths
+	// that are not valid references.
+	//
+	// +optional
+	MalformedReferenceCount int32 `json:"malformedReferenceCount,omitempty"`
+
+	// DeniedClusterScopedReferenceCount is the number of references to
+	// cluster-scoped resources that were denied to at least one consumer.
+	// ReferenceGrants live in the namespace of the referenced resources and
+	// can not allow these, only the BaselineGrant of a
+	// ClusterReferenceConsumer can.
+	//
+	// +optional
+	DeniedClusterScopedReferenceCount int32 `json:"deniedClusterScopedReferenceCount,omitempty"`
+
+	// Conditions describe the current state of the ClusterReferencePattern.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +kubebuilder:validation:MaxItems=8
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// UnresolvedReference describes a reference whose kind could not be mapped to
+// a resource.
+type UnresolvedReference struct {
+	// Referrer identifies the object the reference comes from.
+	Referrer ReferrerRef `json:"referrer"`
+
+	// Group is the group of the referenced kind.
+	Group string `json:"group"`
+
+	// Kind is the kind that could not be resolved.
+	Kind string `json:"kind"`
+
+	// Name is the name of the referenced object.
+	Name string `json:"name"`
+
+	// Message describes why the kind could not be resolved.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=1024
+	Message string `json:"message,omitempty"`
+}
+
+// MalformedReference describes a match of a path that is not a valid
+// reference.
+type MalformedReference struct {
+	// Referrer identifies the object the match comes from.
+	Referrer ReferrerRef `json:"referrer"`
+
+	// Path is the path or expression that produced the match.
+	Path string `json:"path"`
+
+	// Message describes why the match is not a valid reference.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=1024
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,435 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"sigs.k8s.io/referencegrant-poc/apis/v1beta1"
+)
+
+// annotationSingularPath is set on v1beta1 ClusterReferencePatterns converted
+// from a v1alpha1 object with Path set. v1beta1 only has Paths, so the
+// annotation lets the first entry be restored to Path when converting back.
+const annotationSingularPath = "v1alpha1.reference.authorization.k8s.io/singular-path"
+
+// annotationSingularPatternName is set on v1beta1 grants converted from a
+// v1alpha1 object with PatternName set. v1beta1 only has PatternNames, so the
+// annotation lets a single entry be restored to PatternName when converting
+// back.
+const annotationSingularPatternName = "v1alpha1.reference.authorization.k8s.io/singular-pattern-name"
+
+// ConvertTo converts this ClusterReferencePattern to the hub version.
+func (src *ClusterReferencePattern) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.ClusterReferencePattern)
+
+	// Version used to be optional in v1alpha1. Objects created without one
+	// were never programmed, the controller needs the version to list
+	// referrers. It is copied as is so they can still be read, v1beta1
+	// validation asks for a version on their next update.
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Group = src.Group
+	dst.Resource = src.Resource
+	dst.Version = src.Version
+	dst.ClusterScopedReferrers = v1beta1.ClusterScopedReferrerPolicy(src.ClusterScopedReferrers)
+
+	dst.Paths = nil
+	if src.Path != "" {
+		dst.Paths = append(dst.Paths, v1beta1.ReferencePath{Path: src.Path})
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[annotationSingularPath] = "true"
+	}
+	for _, p := range src.Paths {
+		dst.Paths = append(dst.Paths, v1beta1.ReferencePath{
+			Path:       p.Path,
+			Expression: p.Expression,
+			Targets:    convertTargetsTo(p.Targets),
+		})
+	}
+
+	dst.Verbs = nil
+	for _, v := range src.Verbs {
+		dst.Verbs = append(dst.Verbs, v1beta1.ReferenceVerb(v))
+	}
+
+	dst.Status = v1beta1.ClusterReferencePatternStatus{
+		ObservedGeneration:                src.Status.ObservedGeneration,
+		UnresolvedReferenceCount:          src.Status.UnresolvedReferenceCount,
+		MalformedReferenceCount:           src.Status.MalformedReferenceCount,
+		DeniedClusterScopedReferenceCount: src.Status.DeniedClusterScopedReferenceCount,
+		Conditions:                        copyConditions(src.Status.Conditions),
+	}
+	for _, mr := range src.Status.MalformedReferences {
+		dst.Status.MalformedReferences = append(dst.Status.MalformedReferences, v1beta1.MalformedReference{
+			Referrer: v1beta1.ReferrerRef(mr.Referrer),
+			Path:     mr.Path,
+			Message:  mr.Message,
+		})
+	}
+	for _, ur := range src.Status.UnresolvedReferences {
+		dst.Status.UnresolvedReferences = append(dst.Status.UnresolvedReferences, v1beta1.UnresolvedReference{
+			Referrer: v1beta1.ReferrerRef(ur.Referrer),
+			Group:    ur.Group,
+			Kind:     ur.Kind,
+			Name:     ur.Name,
+			Message:  ur.Message,
+		})
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this ClusterReferencePattern.
+func (dst *ClusterReferencePattern) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.ClusterReferencePattern)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Group = src.Group
+	dst.Resource = src.Resource
+	dst.Version = src.Version
+	dst.ClusterScopedReferrers = ClusterScopedReferrerPolicy(src.ClusterScopedReferrers)
+
+	paths := src.Paths
+	dst.Path = ""
+	if _, ok := dst.Annotations[annotationSingularPath]; ok {
+		delete(dst.Annotations, annotationSingularPath)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		if len(paths) > 0 && paths[0].Expression == "" && len(paths[0].Targets) == 0 {
+			dst.Path = paths[0].Path
+			paths = paths[1:]
+		}
+	}
+	dst.Paths = nil
+	for _, p := range paths {
+		dst.Paths = append(dst.Paths, ReferencePath{
+			Path:       p.Path,
+			Expression: p.Expression,
+			Targets:    convertTargetsFrom(p.Targets),
+		})
+	}
+
+	dst.Verbs = nil
+	for _, v := range src.Verbs {
+		dst.Verbs = append(dst.Verbs, ReferenceVerb(v))
+	}
+
+	dst.Status = ClusterReferencePatternStatus{
+		ObservedGeneration:                src.Status.ObservedGeneration,
+		UnresolvedReferenceCount:          src.Status.UnresolvedReferenceCount,
+		MalformedReferenceCount:           src.Status.MalformedReferenceCount,
+		DeniedClusterScopedReferenceCount: src.Status.DeniedClusterScopedReferenceCount,
+		Conditions:                        copyConditions(src.Status.Conditions),
+	}
+	for _, mr := range src.Status.MalformedReferences {
+		dst.Status.MalformedReferences = append(dst.Status.MalformedReferences, MalformedReference{
+			Referrer: ReferrerRef(mr.Referrer),
+			Path:     mr.Path,
+			Message:  mr.Message,
+		})
+	}
+	for _, ur := range src.Status.UnresolvedReferences {
+		dst.Status.UnresolvedReferences = append(dst.Status.UnresolvedReferences, UnresolvedReference{
+			Referrer: ReferrerRef(ur.Referrer),
+			Group:    ur.Group,
+			Kind:     ur.Kind,
+			Name:     ur.Name,
+			Message:  ur.Message,
+		})
+	}
+
+	return nil
+}
+
+func convertTargetsTo(in []ReferenceTarget) []v1beta1.ReferenceTarget {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1beta1.ReferenceTarget, 0, len(in))
+	for _, t := range in {
+		out = append(out, v1beta1.ReferenceTarget{Group: t.Group, Resource: t.Resource})
+	}
+	return out
+}
+
+func convertTargetsFrom(in []v1beta1.ReferenceTarget) []ReferenceTarget {
+	if in == nil {
+		return nil
+	}
+	out := make([]ReferenceTarget, 0, len(in))
+	for _, t := range in {
+		out = append(out, ReferenceTarget{Group: t.Group, Resource: t.Resource})
+	}
+	return out
+}
+
+// ConvertTo converts this ClusterReferenceConsumer to the hub version.
+func (src *ClusterReferenceConsumer) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.ClusterReferenceConsumer)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Subject = src.Subject
+	dst.PatternNames = copyStrings(src.PatternNames)
+	dst.BaselineGrant = v1beta1.BaselineGrantType(src.BaselineGrant)
+	dst.Status = v1beta1.ClusterReferenceConsumerStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		Conditions:         copyConditions(src.Status.Conditions),
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this ClusterReferenceConsumer.
+func (dst *ClusterReferenceConsumer) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.ClusterReferenceConsumer)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Subject = src.Subject
+	dst.PatternNames = copyStrings(src.PatternNames)
+	dst.BaselineGrant = BaselineGrantType(src.BaselineGrant)
+	dst.Status = ClusterReferenceConsumerStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		Conditions:         copyConditions(src.Status.Conditions),
+	}
+
+	return nil
+}
+
+// ConvertTo converts this ReferenceGrant to the hub version.
+func (src *ReferenceGrant) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.ReferenceGrant)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.PatternNames = convertPatternNamesTo(&dst.ObjectMeta, src.PatternName, src.PatternNames)
+	dst.PatternSelector = src.PatternSelector.DeepCopy()
+	dst.From = convertGrantFromTo(src.From)
+	dst.To = convertGrantToTo(src.To)
+	dst.ConsumerNames = copyStrings(src.ConsumerNames)
+	dst.Status = convertGrantStatusTo(&src.Status)
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this ReferenceGrant.
+func (dst *ReferenceGrant) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.ReferenceGrant)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.PatternName, dst.PatternNames = convertPatternNamesFrom(&dst.ObjectMeta, src.PatternNames)
+	dst.PatternSelector = src.PatternSelector.DeepCopy()
+	dst.From = convertGrantFromFrom(src.From)
+	dst.To = convertGrantToFrom(src.To)
+	dst.ConsumerNames = copyStrings(src.ConsumerNames)
+	dst.Status = convertGrantStatusFrom(&src.Status)
+
+	return nil
+}
+
+// ConvertTo converts this ClusterReferenceGrant to the hub version.
+func (src *ClusterReferenceGrant) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.ClusterReferenceGrant)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.PatternNames = convertPatternNamesTo(&dst.ObjectMeta, src.PatternName, src.PatternNames)
+	dst.PatternSelector = src.PatternSelector.DeepCopy()
+	dst.TargetNamespaceSelector = *src.TargetNamespaceSelector.DeepCopy()
+	dst.From = convertGrantFromTo(src.From)
+	dst.To = convertGrantToTo(src.To)
+	dst.ConsumerNames = copyStrings(src.ConsumerNames)
+	dst.Status = convertGrantStatusTo(&src.Status)
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this ClusterReferenceGrant.
+func (dst *ClusterReferenceGrant) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.ClusterReferenceGrant)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.PatternName, dst.PatternNames = convertPatternNamesFrom(&dst.ObjectMeta, src.PatternNames)
+	dst.PatternSelector = src.PatternSelector.DeepCopy()
+	dst.TargetNamespaceSelector = *src.TargetNamespaceSelector.DeepCopy()
+	dst.From = convertGrantFromFrom(src.From)
+	dst.To = convertGrantToFrom(src.To)
+	dst.ConsumerNames = copyStrings(src.ConsumerNames)
+	dst.Status = convertGrantStatusFrom(&src.Status)
+
+	return nil
+}
+
+// convertPatternNamesTo merges PatternName into the v1beta1 PatternNames and
+// records it in meta so it can be restored.
+func convertPatternNamesTo(meta *metav1.ObjectMeta, name string, names []string) []string {
+	if name == "" {
+		return copyStrings(names)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[annotationSingularPatternName] = "true"
+	return append([]string{name}, names...)
+}
+
+// convertPatternNamesFrom restores PatternName from the v1beta1 PatternNames
+// if it was recorded in meta and still names a single pattern.
+func convertPatternNamesFrom(meta *metav1.ObjectMeta, names []string) (string, []string) {
+	if _, ok := meta.Annotations[annotationSingularPatternName]; !ok {
+		return "", copyStrings(names)
+	}
+	delete(meta.Annotations, annotationSingularPatternName)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	if len(names) != 1 {
+		return "", copyStrings(names)
+	}
+	return names[0], nil
+}
+
+func convertGrantFromTo(in []ReferenceGrantFrom) []v1beta1.ReferenceGrantFrom {
+	var out []v1beta1.ReferenceGrantFrom
+	for _, f := range in {
+		out = append(out, v1beta1.ReferenceGrantFrom{
+			Namespace:         f.Namespace,
+			NamespaceSelector: f.NamespaceSelector.DeepCopy(),
+			ClusterScoped:     f.ClusterScoped,
+			Name:              f.Name,
+			Selector:          f.Selector.DeepCopy(),
+		})
+	}
+	return out
+}
+
+func convertGrantFromFrom(in []v1beta1.ReferenceGrantFrom) []ReferenceGrantFrom {
+	var out []ReferenceGrantFrom
+	for _, f := range in {
+		out = append(out, ReferenceGrantFrom{
+			Namespace:         f.Namespace,
+			NamespaceSelector: f.NamespaceSelector.DeepCopy(),
+			ClusterScoped:     f.ClusterScoped,
+			Name:              f.Name,
+			Selector:          f.Selector.DeepCopy(),
+		})
+	}
+	return out
+}
+
+func convertGrantToTo(in []ReferenceGrantTo) []v1beta1.ReferenceGrantTo {
+	var out []v1beta1.ReferenceGrantTo
+	for _, t := range in {
+		out = append(out, v1beta1.ReferenceGrantTo{
+			Group:      t.Group,
+			Resource:   t.Resource,
+			Name:       t.Name,
+			NamePrefix: t.NamePrefix,
+			Selector:   t.Selector.DeepCopy(),
+		})
+	}
+	return out
+}
+
+func convertGrantToFrom(in []v1beta1.ReferenceGrantTo) []ReferenceGrantTo {
+	var out []ReferenceGrantTo
+	for _, t := range in {
+		out = append(out, ReferenceGrantTo{
+			Group:      t.Group,
+			Resource:   t.Resource,
+			Name:       t.Name,
+			NamePrefix: t.NamePrefix,
+			Selector:   t.Selector.DeepCopy(),
+		})
+	}
+	return out
+}
+
+func convertGrantStatusTo(src *ReferenceGrantStatus) v1beta1.ReferenceGrantStatus {
+	dst := v1beta1.ReferenceGrantStatus{
+		ObservedGeneration:       src.ObservedGeneration,
+		AuthorizedReferenceCount: src.AuthorizedReferenceCount,
+		Consumers:                copyStrings(src.Consumers),
+		DeniedReferenceCount:     src.DeniedReferenceCount,
+		Conditions:               copyConditions(src.Conditions),
+	}
+	for _, ar := range src.AuthorizedReferences {
+		dst.AuthorizedReferences = append(dst.AuthorizedReferences, v1beta1.AuthorizedReference{
+			Pattern:  ar.Pattern,
+			Referrer: v1beta1.ReferrerRef(ar.Referrer),
+			Group:    ar.Group,
+			Resource: ar.Resource,
+			Name:     ar.Name,
+		})
+	}
+	for _, ps := range src.Patterns {
+		dst.Patterns = append(dst.Patterns, v1beta1.ReferenceGrantPatternStatus{
+			Name:                     ps.Name,
+			AuthorizedReferenceCount: ps.AuthorizedReferenceCount,
+			Consumers:                copyStrings(ps.Consumers),
+			DeniedReferenceCount:     ps.DeniedReferenceCount,
+		})
+	}
+	return dst
+}
+
+func convertGrantStatusFrom(src *v1beta1.ReferenceGrantStatus) ReferenceGrantStatus {
+	dst := ReferenceGrantStatus{
+		ObservedGeneration:       src.ObservedGeneration,
+		AuthorizedReferenceCount: src.AuthorizedReferenceCount,
+		Consumers:                copyStrings(src.Consumers),
+		DeniedReferenceCount:     src.DeniedReferenceCount,
+		Conditions:               copyConditions(src.Conditions),
+	}
+	for _, ar := range src.AuthorizedReferences {
+		dst.AuthorizedReferences = append(dst.AuthorizedReferences, AuthorizedReference{
+			Pattern:  ar.Pattern,
+			Referrer: ReferrerRef(ar.Referrer),
+			Group:    ar.Group,
+			Resource: ar.Resource,
+			Name:     ar.Name,
+		})
+	}
+	for _, ps := range src.Patterns {
+		dst.Patterns = append(dst.Patterns, ReferenceGrantPatternStatus{
+			Name:                     ps.Name,
+			AuthorizedReferenceCount: ps.AuthorizedReferenceCount,
+			Consumers:                copyStrings(ps.Consumers),
+			DeniedReferenceCount:     ps.DeniedReferenceCount,
+		})
+	}
+	return dst
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	return append([]string{}, in...)
+}
+
+func copyConditions(in []metav1.Condition) []metav1.Condition {
+	if in == nil {
+		return nil
+	}
+	out := make([]metav1.Condition, len(in))
+	for i := range in {
+		in[i].DeepCopyInto(&out[i])
+	}
+	return out
+}
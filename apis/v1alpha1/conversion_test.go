@@ -0,0 +1,326 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/referencegrant-poc/apis/v1beta1"
+)
+
+var testConditions = []metav1.Condition{{
+	Type:               "Accepted",
+	Status:             metav1.ConditionTrue,
+	ObservedGeneration: 2,
+	LastTransitionTime: metav1.Unix(1700000000, 0),
+	Reason:             "Accepted",
+}}
+
+var testReferrer = ReferrerRef{Group: "gateway.networking.k8s.io", Resource: "gateways", Namespace: "infra", Name: "gw"}
+
+func TestClusterReferencePatternRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		crp  *ClusterReferencePattern
+	}{{
+		name: "singular path",
+		crp: &ClusterReferencePattern{
+			ObjectMeta: metav1.ObjectMeta{Name: "gateway-secrets"},
+			Group:      "gateway.networking.k8s.io",
+			Resource:   "gateways",
+			Version:    "v1",
+			Path:       ".spec.listeners[*].tls.certificateRefs[*]",
+		},
+	}, {
+		name: "singular path with paths and annotations",
+		crp: &ClusterReferencePattern{
+			ObjectMeta: metav1.ObjectMeta{Name: "gateway-secrets", Annotations: map[string]string{"example.com/owner": "infra"}},
+			Group:      "gateway.networking.k8s.io",
+			Resource:   "gateways",
+			Version:    "v1",
+			Path:       ".spec.listeners[*].tls.certificateRefs[*]",
+			Paths: []ReferencePath{{
+				Path:    ".spec.infrastructure.parametersRef",
+				Targets: []ReferenceTarget{{Group: "", Resource: "configmaps"}},
+			}},
+		},
+	}, {
+		// Created before version was required in v1alpha1.
+		name: "without version",
+		crp: &ClusterReferencePattern{
+			ObjectMeta: metav1.ObjectMeta{Name: "gateway-secrets"},
+			Group:      "gateway.networking.k8s.io",
+			Resource:   "gateways",
+			Path:       ".spec.listeners[*].tls.certificateRefs[*]",
+		},
+	}, {
+		name: "paths and expressions",
+		crp: &ClusterReferencePattern{
+			ObjectMeta: metav1.ObjectMeta{Name: "httproute-services", Generation: 2},
+			Group:      "gateway.networking.k8s.io",
+			Resource:   "httproutes",
+			Version:    "v1",
+			Paths: []ReferencePath{{
+				Path: ".spec.rules[*].backendRefs[*]",
+			}, {
+				Expression: "object.spec.rules.map(r, r.backendRefs.map(b, {'group': '', 'resource': 'services', 'name': b.name}))",
+				Targets:    []ReferenceTarget{{Group: "", Resource: "services"}},
+			}},
+			Verbs:                  []ReferenceVerb{ReferenceVerbGet, ReferenceVerbWatch},
+			ClusterScopedReferrers: ClusterScopedReferrerIgnore,
+			Status: ClusterReferencePatternStatus{
+				ObservedGeneration: 2,
+				UnresolvedReferences: []UnresolvedReference{{
+					Referrer: testReferrer,
+					Group:    "example.com",
+					Kind:     "Backend",
+					Name:     "missing",
+					Message:  "no matches for kind",
+				}},
+				UnresolvedReferenceCount: 1,
+				MalformedReferences: []MalformedReference{{
+					Referrer: testReferrer,
+					Path:     ".spec.rules[*].backendRefs[*]",
+					Message:  "name must be a string",
+				}},
+				MalformedReferenceCount:           1,
+				DeniedClusterScopedReferenceCount: 3,
+				Conditions:                        testConditions,
+			},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := &v1beta1.ClusterReferencePattern{}
+			if err := tc.crp.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+			got := &ClusterReferencePattern{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom failed: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(tc.crp, got) {
+				t.Errorf("round trip mismatch\nwant: %+v\ngot:  %+v", tc.crp, got)
+			}
+		})
+	}
+}
+
+func TestClusterReferenceConsumerRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		crc  *ClusterReferenceConsumer
+	}{{
+		name: "minimal",
+		crc: &ClusterReferenceConsumer{
+			ObjectMeta:   metav1.ObjectMeta{Name: "gateway-controller"},
+			Subject:      rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "gateway-system", Name: "controller"},
+			PatternNames: []string{"gateway-secrets"},
+		},
+	}, {
+		name: "baseline and status",
+		crc: &ClusterReferenceConsumer{
+			ObjectMeta:    metav1.ObjectMeta{Name: "gateway-controller", Generation: 2},
+			Subject:       rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "gateway-controllers"},
+			PatternNames:  []string{"gateway-secrets", "httproute-services"},
+			BaselineGrant: BaselineGrantSameNamespace,
+			Status: ClusterReferenceConsumerStatus{
+				ObservedGeneration: 2,
+				Conditions:         testConditions,
+			},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := &v1beta1.ClusterReferenceConsumer{}
+			if err := tc.crc.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+			got := &ClusterReferenceConsumer{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom failed: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(tc.crc, got) {
+				t.Errorf("round trip mismatch\nwant: %+v\ngot:  %+v", tc.crc, got)
+			}
+		})
+	}
+}
+
+var testGrantStatus = ReferenceGrantStatus{
+	ObservedGeneration: 3,
+	AuthorizedReferences: []AuthorizedReference{{
+		Pattern:  "gateway-secrets",
+		Referrer: testReferrer,
+		Group:    "",
+		Resource: "secrets",
+		Name:     "tls",
+	}},
+	AuthorizedReferenceCount: 1,
+	Consumers:                []string{"gateway-controller"},
+	DeniedReferenceCount:     2,
+	Patterns: []ReferenceGrantPatternStatus{{
+		Name:                     "gateway-secrets",
+		AuthorizedReferenceCount: 1,
+		Consumers:                []string{"gateway-controller"},
+		DeniedReferenceCount:     2,
+	}},
+	Conditions: testConditions,
+}
+
+func TestReferenceGrantRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		rg   *ReferenceGrant
+	}{{
+		name: "pattern name",
+		rg: &ReferenceGrant{
+			ObjectMeta:  metav1.ObjectMeta{Namespace: "certs", Name: "gateway-secrets"},
+			PatternName: "gateway-secrets",
+			From:        []ReferenceGrantFrom{{Namespace: "infra"}},
+			To:          []ReferenceGrantTo{{Group: "", Resource: "secrets", Name: "tls"}},
+		},
+	}, {
+		name: "pattern names",
+		rg: &ReferenceGrant{
+			ObjectMeta:   metav1.ObjectMeta{Namespace: "certs", Name: "gateway-secrets", Annotations: map[string]string{"example.com/owner": "certs"}},
+			PatternNames: []string{"gateway-secrets"},
+			From: []ReferenceGrantFrom{{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "infra"}},
+				Selector:          &metav1.LabelSelector{MatchLabels: map[string]string{"app": "gw"}},
+			}},
+			To:            []ReferenceGrantTo{{Group: "", Resource: "secrets", NamePrefix: "tls-"}},
+			ConsumerNames: []string{"gateway-controller"},
+		},
+	}, {
+		name: "pattern selector and status",
+		rg: &ReferenceGrant{
+			ObjectMeta:      metav1.ObjectMeta{Namespace: "certs", Name: "gateway-secrets", Generation: 3},
+			PatternSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kind": "secrets"}},
+			From:            []ReferenceGrantFrom{{ClusterScoped: true, Name: "shared"}},
+			To: []ReferenceGrantTo{{
+				Group:    "",
+				Resource: "secrets",
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"shared": "true"}},
+			}},
+			Status: testGrantStatus,
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := &v1beta1.ReferenceGrant{}
+			if err := tc.rg.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+			got := &ReferenceGrant{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom failed: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(tc.rg, got) {
+				t.Errorf("round trip mismatch\nwant: %+v\ngot:  %+v", tc.rg, got)
+			}
+		})
+	}
+}
+
+func TestClusterReferenceGrantRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		crg  *ClusterReferenceGrant
+	}{{
+		name: "pattern name",
+		crg: &ClusterReferenceGrant{
+			ObjectMeta:              metav1.ObjectMeta{Name: "gateway-secrets"},
+			PatternName:             "gateway-secrets",
+			TargetNamespaceSelector: metav1.LabelSelector{},
+			From:                    []ReferenceGrantFrom{{Namespace: "infra"}},
+		},
+	}, {
+		name: "pattern names and status",
+		crg: &ClusterReferenceGrant{
+			ObjectMeta:   metav1.ObjectMeta{Name: "gateway-secrets", Generation: 3},
+			PatternNames: []string{"gateway-secrets", "httproute-services"},
+			TargetNamespaceSelector: metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"shared"}}},
+			},
+			From:          []ReferenceGrantFrom{{NamespaceSelector: &metav1.LabelSelector{}}},
+			To:            []ReferenceGrantTo{{Group: "", Resource: "secrets"}},
+			ConsumerNames: []string{"gateway-controller"},
+			Status:        testGrantStatus,
+		},
+	}, {
+		name: "pattern selector",
+		crg: &ClusterReferenceGrant{
+			ObjectMeta:              metav1.ObjectMeta{Name: "gateway-secrets"},
+			PatternSelector:         &metav1.LabelSelector{MatchLabels: map[string]string{"kind": "secrets"}},
+			TargetNamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tier": "shared"}},
+			From:                    []ReferenceGrantFrom{{Namespace: "infra", Name: "gw"}},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := &v1beta1.ClusterReferenceGrant{}
+			if err := tc.crg.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+			got := &ClusterReferenceGrant{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom failed: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(tc.crg, got) {
+				t.Errorf("round trip mismatch\nwant: %+v\ngot:  %+v", tc.crg, got)
+			}
+		})
+	}
+}
+
+// A v1beta1 client may replace the single pattern recorded by the
+// annotation, which then can no longer be restored to PatternName.
+func TestReferenceGrantConvertFromEditedPatternNames(t *testing.T) {
+	rg := &ReferenceGrant{
+		ObjectMeta:  metav1.ObjectMeta{Namespace: "certs", Name: "gateway-secrets"},
+		PatternName: "gateway-secrets",
+		From:        []ReferenceGrantFrom{{Namespace: "infra"}},
+	}
+	hub := &v1beta1.ReferenceGrant{}
+	if err := rg.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+	if want := []string{"gateway-secrets"}; !apiequality.Semantic.DeepEqual(hub.PatternNames, want) {
+		t.Errorf("expected hub patternNames %v, got %v", want, hub.PatternNames)
+	}
+
+	hub.PatternNames = append(hub.PatternNames, "httproute-services")
+	got := &ReferenceGrant{}
+	if err := got.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+	if got.PatternName != "" || len(got.PatternNames) != 2 {
+		t.Errorf("expected patternNames only, got patternName %q and patternNames %v", got.PatternName, got.PatternNames)
+	}
+	if _, ok := got.Annotations[annotationSingularPatternName]; ok {
+		t.Errorf("expected annotation %s to be removed", annotationSingularPatternName)
+	}
+}
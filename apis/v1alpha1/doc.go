@@ -14,7 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package v1beta1 contains API Schema definitions for the
+// Package v1alpha1 contains API Schema definitions for the
 // reference.authorization.k8s.io API group.
 //
 // +kubebuilder:object:generate=true
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Condition types shared by all resources in this API group.
+const (
+	// ConditionAccepted indicates whether the resource is valid and has been
+	// accepted by the controller.
+	ConditionAccepted = "Accepted"
+
+	// ConditionResolvedRefs indicates whether everything the resource refers
+	// to could be resolved.
+	ConditionResolvedRefs = "ResolvedRefs"
+
+	// ConditionProgrammed indicates whether the RBAC resulting from the
+	// resource has been successfully written.
+	ConditionProgrammed = "Programmed"
+)
+
+// Condition reasons shared by all resources in this API group.
+const (
+	// ReasonAccepted is used with the Accepted condition when it is true.
+	ReasonAccepted = "Accepted"
+
+	// ReasonInvalidPath is used with the Accepted condition when the path of
+	// a ClusterReferencePattern can not be parsed.
+	ReasonInvalidPath = "InvalidPath"
+
+	// ReasonVerbsNotAllowed is used with the Accepted condition when a
+	// ClusterReferencePattern requests verbs the controller does not allow.
+	ReasonVerbsNotAllowed = "VerbsNotAllowed"
+
+	// ReasonResolvedRefs is used with the ResolvedRefs condition when it is
+	// true.
+	ReasonResolvedRefs = "ResolvedRefs"
+
+	// ReasonReferrerNotFound is used with the ResolvedRefs condition when the
+	// referrer resource of a ClusterReferencePattern is not served.
+	ReasonReferrerNotFound = "ReferrerNotFound"
+
+	// ReasonReferrerNotSynced is used with the ResolvedRefs condition while
+	// the referrers of a ClusterReferencePattern could not be listed yet.
+	ReasonReferrerNotSynced = "ReferrerNotSynced"
+
+	// ReasonUnresolvedReferences is used with the ResolvedRefs condition when
+	// the kind of some references could not be mapped to a resource.
+	ReasonUnresolvedReferences = "UnresolvedReferences"
+
+	// ReasonMalformedReferences is used with the ResolvedRefs condition when
+	// some matches of the paths of a ClusterReferencePattern are not valid
+	// references.
+	ReasonMalformedReferences = "MalformedReferences"
+
+	// ReasonPatternNotFound is used with the ResolvedRefs condition when a
+	// referenced ClusterReferencePattern does not exist.
+	ReasonPatternNotFound = "PatternNotFound"
+
+	// ReasonProgrammed is used with the Programmed condition when it is true.
+	ReasonProgrammed = "Programmed"
+
+	// ReasonPending is used when a condition can not be determined yet
+	// because of another condition, for example when RBAC has not been
+	// written because the pattern was not accepted.
+	ReasonPending = "Pending"
+
+	// ReasonRBACFailed is used with the Programmed condition when writing
+	// RBAC failed.
+	ReasonRBACFailed = "RBACFailed"
+)
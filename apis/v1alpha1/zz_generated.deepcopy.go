@@ -21,9 +21,26 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthorizedReference) DeepCopyInto(out *AuthorizedReference) {
+	*out = *in
+	out.Referrer = in.Referrer
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthorizedReference.
+func (in *AuthorizedReference) DeepCopy() *AuthorizedReference {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthorizedReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterReferenceConsumer) DeepCopyInto(out *ClusterReferenceConsumer) {
 	*out = *in
@@ -35,6 +52,7 @@ func (in *ClusterReferenceConsumer) DeepCopyInto(out *ClusterReferenceConsumer)
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReferenceConsumer.
@@ -87,11 +105,134 @@ func (in *ClusterReferenceConsumerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReferenceConsumerStatus) DeepCopyInto(out *ClusterReferenceConsumerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReferenceConsumerStatus.
+func (in *ClusterReferenceConsumerStatus) DeepCopy() *ClusterReferenceConsumerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReferenceConsumerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReferenceGrant) DeepCopyInto(out *ClusterReferenceGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.PatternNames != nil {
+		in, out := &in.PatternNames, &out.PatternNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PatternSelector != nil {
+		in, out := &in.PatternSelector, &out.PatternSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.TargetNamespaceSelector.DeepCopyInto(&out.TargetNamespaceSelector)
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]ReferenceGrantFrom, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]ReferenceGrantTo, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConsumerNames != nil {
+		in, out := &in.ConsumerNames, &out.ConsumerNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReferenceGrant.
+func (in *ClusterReferenceGrant) DeepCopy() *ClusterReferenceGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReferenceGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterReferenceGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReferenceGrantList) DeepCopyInto(out *ClusterReferenceGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterReferenceGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReferenceGrantList.
+func (in *ClusterReferenceGrantList) DeepCopy() *ClusterReferenceGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReferenceGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterReferenceGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterReferencePattern) DeepCopyInto(out *ClusterReferencePattern) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]ReferencePath, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Verbs != nil {
+		in, out := &in.Verbs, &out.Verbs
+		*out = make([]ReferenceVerb, len(*in))
+		copy(*out, *in)
+	}
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReferencePattern.
@@ -144,21 +285,89 @@ func (in *ClusterReferencePatternList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReferencePatternStatus) DeepCopyInto(out *ClusterReferencePatternStatus) {
+	*out = *in
+	if in.UnresolvedReferences != nil {
+		in, out := &in.UnresolvedReferences, &out.UnresolvedReferences
+		*out = make([]UnresolvedReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.MalformedReferences != nil {
+		in, out := &in.MalformedReferences, &out.MalformedReferences
+		*out = make([]MalformedReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReferencePatternStatus.
+func (in *ClusterReferencePatternStatus) DeepCopy() *ClusterReferencePatternStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReferencePatternStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MalformedReference) DeepCopyInto(out *MalformedReference) {
+	*out = *in
+	out.Referrer = in.Referrer
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MalformedReference.
+func (in *MalformedReference) DeepCopy() *MalformedReference {
+	if in == nil {
+		return nil
+	}
+	out := new(MalformedReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReferenceGrant) DeepCopyInto(out *ReferenceGrant) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.PatternNames != nil {
+		in, out := &in.PatternNames, &out.PatternNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PatternSelector != nil {
+		in, out := &in.PatternSelector, &out.PatternSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.From != nil {
 		in, out := &in.From, &out.From
 		*out = make([]ReferenceGrantFrom, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.To != nil {
 		in, out := &in.To, &out.To
 		*out = make([]ReferenceGrantTo, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConsumerNames != nil {
+		in, out := &in.ConsumerNames, &out.ConsumerNames
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrant.
@@ -182,6 +391,16 @@ func (in *ReferenceGrant) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReferenceGrantFrom) DeepCopyInto(out *ReferenceGrantFrom) {
 	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantFrom.
@@ -226,9 +445,73 @@ func (in *ReferenceGrantList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrantPatternStatus) DeepCopyInto(out *ReferenceGrantPatternStatus) {
+	*out = *in
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantPatternStatus.
+func (in *ReferenceGrantPatternStatus) DeepCopy() *ReferenceGrantPatternStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrantPatternStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceGrantStatus) DeepCopyInto(out *ReferenceGrantStatus) {
+	*out = *in
+	if in.AuthorizedReferences != nil {
+		in, out := &in.AuthorizedReferences, &out.AuthorizedReferences
+		*out = make([]AuthorizedReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Patterns != nil {
+		in, out := &in.Patterns, &out.Patterns
+		*out = make([]ReferenceGrantPatternStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantStatus.
+func (in *ReferenceGrantStatus) DeepCopy() *ReferenceGrantStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceGrantStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReferenceGrantTo) DeepCopyInto(out *ReferenceGrantTo) {
 	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceGrantTo.
@@ -240,3 +523,69 @@ func (in *ReferenceGrantTo) DeepCopy() *ReferenceGrantTo {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferencePath) DeepCopyInto(out *ReferencePath) {
+	*out = *in
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]ReferenceTarget, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferencePath.
+func (in *ReferencePath) DeepCopy() *ReferencePath {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferencePath)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferenceTarget) DeepCopyInto(out *ReferenceTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferenceTarget.
+func (in *ReferenceTarget) DeepCopy() *ReferenceTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferenceTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferrerRef) DeepCopyInto(out *ReferrerRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferrerRef.
+func (in *ReferrerRef) DeepCopy() *ReferrerRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferrerRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnresolvedReference) DeepCopyInto(out *UnresolvedReference) {
+	*out = *in
+	out.Referrer = in.Referrer
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnresolvedReference.
+func (in *UnresolvedReference) DeepCopy() *UnresolvedReference {
+	if in == nil {
+		return nil
+	}
+	out := new(UnresolvedReference)
+	in.DeepCopyInto(out)
+	return out
+}
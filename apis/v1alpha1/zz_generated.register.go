@@ -60,6 +60,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&ClusterReferenceConsumer{},
 		&ClusterReferenceConsumerList{},
+		&ClusterReferenceGrant{},
+		&ClusterReferenceGrantList{},
 		&ClusterReferencePattern{},
 		&ClusterReferencePatternList{},
 		&ReferenceGrant{},
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=crc
+// +kubebuilder:metadata:annotations=api-approved.kubernetes.io=unapproved
+// +kubebuilder:printcolumn:name="Accepted",type=string,JSONPath=`.status.conditions[?(@.type=="Accepted")].status`
+// +kubebuilder:printcolumn:name="Programmed",type=string,JSONPath=`.status.conditions[?(@.type=="Programmed")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// ClusterReferenceConsumer identifies a common form of referencing pattern. This
+// can then be used with ReferenceGrants to selectively allow references.
+type ClusterReferenceConsumer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Subject refers to the subject that is a consumer of the referenced
+	// pattern(s).
+	//
+	// +kubebuilder:validation:XValidation:message="kind must be one of ServiceAccount, User or Group",rule="self.kind in ['ServiceAccount', 'User', 'Group']"
+	// +kubebuilder:validation:XValidation:message="namespace is required for ServiceAccount subjects",rule="self.kind != 'ServiceAccount' || (has(self.__namespace__) && self.__namespace__ != '')"
+	// +kubebuilder:validation:XValidation:message="namespace must not be set for User and Group subjects",rule="self.kind == 'ServiceAccount' || !has(self.__namespace__) || self.__namespace__ == ''"
+	// +kubebuilder:validation:XValidation:message="namespace of ServiceAccount subjects must be a valid DNS label",rule="self.kind != 'ServiceAccount' || !has(self.__namespace__) || (size(self.__namespace__) <= 63 && self.__namespace__.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$'))"
+	// +kubebuilder:validation:XValidation:message="apiGroup must be empty for ServiceAccount subjects and rbac.authorization.k8s.io for User and Group subjects",rule="self.kind == 'ServiceAccount' ? (!has(self.apiGroup) || self.apiGroup == '') : (!has(self.apiGroup) || self.apiGroup == 'rbac.authorization.k8s.io')"
+	Subject rbacv1.Subject `json:"subject"`
+
+	// The names of the ClusterReferencePatterns this consumer implements.
+	//
+	// +listType=set
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:XValidation:message="pattern names must not be empty",rule="self.all(n, n != '')"
+	PatternNames []string `json:"patternNames"`
+
+	// BaselineGrant describes which references this consumer is trusted to
+	// follow without the need for ReferenceGrants. Defaults to SameNamespace.
+	//
+	// +optional
+	// +kubebuilder:default=SameNamespace
+	BaselineGrant BaselineGrantType `json:"baselineGrant,omitempty"`
+
+	// Status describes the current state of the ClusterReferenceConsumer.
+	//
+	// +optional
+	Status ClusterReferenceConsumerStatus `json:"status,omitempty"`
+}
+
+// BaselineGrantType describes the set of references that are allowed by
+// default, without the need for ReferenceGrants.
+//
+// +kubebuilder:validation:Enum=None;SameNamespace;All
+type BaselineGrantType string
+
+const (
+	// BaselineGrantNone requires a ReferenceGrant for every reference,
+	// including references within the same namespace.
+	BaselineGrantNone BaselineGrantType = "None"
+
+	// BaselineGrantSameNamespace allows references within the same namespace
+	// by default. References from cluster-scoped referrers to cluster-scoped
+	// resources count as the same namespace. Cross-namespace references
+	// require a ReferenceGrant.
+	BaselineGrantSameNamespace BaselineGrantType = "SameNamespace"
+
+	// BaselineGrantAll allows all references by default. This should only be
+	// used for trusted cluster components.
+	BaselineGrantAll BaselineGrantType = "All"
+)
+
+// +kubebuilder:object:root=true
+
+// ClusterReferenceConsumerList contains a list of ClusterReferenceConsumer
+type ClusterReferenceConsumerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterReferenceConsumer `json:"items"`
+}
+
+// ClusterReferenceConsumerStatus describes the current state of a ClusterReferenceConsumer.
+type ClusterReferenceConsumerStatus struct {
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	//
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the current state of the ClusterReferenceConsumer.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +kubebuilder:validation:MaxItems=8
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=crg
+// +kubebuilder:metadata:annotations=api-approved.kubernetes.io=unapproved
+// +kubebuilder:printcolumn:name="Accepted",type=string,JSONPath=`.status.conditions[?(@.type=="Accepted")].status`
+// +kubebuilder:printcolumn:name="Programmed",type=string,JSONPath=`.status.conditions[?(@.type=="Programmed")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// ClusterReferenceGrant acts as a ReferenceGrant in every namespace selected
+// by TargetNamespaceSelector. Namespace owners keep precedence: in a namespace
+// with any ReferenceGrant for a pattern, only those ReferenceGrants apply to
+// references following the pattern and ClusterReferenceGrants are ignored.
+// References to cluster-scoped resources are never allowed by a
+// ClusterReferenceGrant.
+//
+// +kubebuilder:validation:XValidation:message="exactly one of patternNames or patternSelector must be set",rule="[has(self.patternNames) && size(self.patternNames) > 0, has(self.patternSelector)].filter(x, x).size() == 1"
+type ClusterReferenceGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// PatternNames refers to the names of the ClusterReferencePatterns this
+	// allows, sharing the same From and To. Exactly one of PatternNames or
+	// PatternSelector must be set.
+	//
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:message="pattern names must not be empty",rule="self.all(n, n != '')"
+	PatternNames []string `json:"patternNames,omitempty"`
+
+	// PatternSelector selects the ClusterReferencePatterns this allows by
+	// their labels.
+	//
+	// +optional
+	PatternSelector *metav1.LabelSelector `json:"patternSelector,omitempty"`
+
+	// TargetNamespaceSelector selects the namespaces of the resources that
+	// may be referenced. An empty selector selects all namespaces.
+	TargetNamespaceSelector metav1.LabelSelector `json:"targetNamespaceSelector"`
+
+	// From describes the trusted namespaces and kinds that can reference the
+	// resources in the selected namespaces.
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	From []ReferenceGrantFrom `json:"from"`
+
+	// To describes the names of resources that may be referenced from the
+	// namespaces described in "From". When unspecified or empty, references
+	// to all resources matching the pattern are allowed.
+	//
+	// +kubebuilder:validation:MaxItems=16
+	To []ReferenceGrantTo `json:"to"`
+
+	// ConsumerNames restricts the grant to the named
+	// ClusterReferenceConsumers. When unspecified, all consumers of the
+	// patterns are trusted.
+	//
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:message="consumer names must not be empty",rule="self.all(n, n != '')"
+	ConsumerNames []string `json:"consumerNames,omitempty"`
+
+	// Status describes the current state of the ClusterReferenceGrant.
+	// DeniedReferenceCount is not reported for ClusterReferenceGrants.
+	//
+	// +optional
+	Status ReferenceGrantStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterReferenceGrantList contains a list of ClusterReferenceGrant
+type ClusterReferenceGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterReferenceGrant `json:"items"`
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// +genclient
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=rg
+// +kubebuilder:metadata:annotations=api-approved.kubernetes.io=unapproved
+// +kubebuilder:printcolumn:name="Accepted",type=string,JSONPath=`.status.conditions[?(@.type=="Accepted")].status`
+// +kubebuilder:printcolumn:name="Programmed",type=string,JSONPath=`.status.conditions[?(@.type=="Programmed")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// ReferenceGrant identifies namespaces of resources that are trusted to
+// reference the specified names of resources in the same namespace as the
+// grant.
+//
+// +kubebuilder:validation:XValidation:message="exactly one of patternNames or patternSelector must be set",rule="[has(self.patternNames) && size(self.patternNames) > 0, has(self.patternSelector)].filter(x, x).size() == 1"
+type ReferenceGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// PatternNames refers to the names of the ClusterReferencePatterns this
+	// allows, sharing the same From and To. Exactly one of PatternNames or
+	// PatternSelector must be set.
+	//
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:message="pattern names must not be empty",rule="self.all(n, n != '')"
+	PatternNames []string `json:"patternNames,omitempty"`
+
+	// PatternSelector selects the ClusterReferencePatterns this allows by
+	// their labels.
+	//
+	// +optional
+	PatternSelector *metav1.LabelSelector `json:"patternSelector,omitempty"`
+
+	// From describes the trusted namespaces and kinds that can reference the
+	// resources described in the Pattern and optionally the "to" list.
+	//
+	// Support: Core
+	//
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	From []ReferenceGrantFrom `json:"from"`
+
+	// To describes the names of resources that may be referenced from the
+	// namespaces described in "From" following the linked pattern. When
+	// unspecified or empty, references to all resources matching the pattern
+	// are allowed.
+	//
+	// +kubebuilder:validation:MaxItems=16
+	To []ReferenceGrantTo `json:"to"`
+
+	// ConsumerNames restricts the grant to the named
+	// ClusterReferenceConsumers. When unspecified, all consumers of the
+	// patterns are trusted.
+	//
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:XValidation:message="consumer names must not be empty",rule="self.all(n, n != '')"
+	ConsumerNames []string `json:"consumerNames,omitempty"`
+
+	// Status describes the current state of the ReferenceGrant.
+	//
+	// +optional
+	Status ReferenceGrantStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ReferenceGrantList contains a list of ReferenceGrant
+type ReferenceGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ReferenceGrant `json:"items"`
+}
+
+// ReferenceGrantFrom describes trusted namespaces and, optionally, the
+// referrers within them. Exactly one of Namespace, NamespaceSelector or
+// ClusterScoped must be set. At most one of Name or Selector may be set to
+// narrow the grant to specific referrers.
+//
+// +kubebuilder:validation:XValidation:message="exactly one of namespace, namespaceSelector or clusterScoped must be set",rule="[has(self.__namespace__) && self.__namespace__ != '', has(self.namespaceSelector), has(self.clusterScoped) && self.clusterScoped].filter(x, x).size() == 1"
+// +kubebuilder:validation:XValidation:message="at most one of name or selector may be set",rule="!(has(self.name) && self.name != '' && has(self.selector))"
+type ReferenceGrantFrom struct {
+	// Namespace is the namespace of the referent.
+	//
+	// Support: Core
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:XValidation:message="namespace must be a valid DNS label",rule="self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$')"
+	Namespace string `json:"namespace,omitempty"`
+
+	// NamespaceSelector trusts all namespaces with matching labels. Grants
+	// follow namespace label changes.
+	//
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// ClusterScoped trusts references from cluster-scoped referrers.
+	//
+	// +optional
+	ClusterScoped bool `json:"clusterScoped,omitempty"`
+
+	// Name restricts the grant to the referrer with this name. When
+	// unspecified, all referrers in the trusted namespaces are trusted.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name,omitempty"`
+
+	// Selector restricts the grant to referrers with matching labels.
+	//
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ReferenceGrantTo describes what Names are allowed as targets of the
+// references. At most one of Name, NamePrefix or Selector may be set.
+//
+// +kubebuilder:validation:XValidation:message="at most one of name, namePrefix or selector may be set",rule="[has(self.name) && self.name != '', has(self.namePrefix) && self.namePrefix != '', has(self.selector)].filter(x, x).size() <= 1"
+type ReferenceGrantTo struct {
+	// Group is the group of the referent.
+	//
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:XValidation:message="group must be empty or a lowercase DNS subdomain",rule="self == '' || self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?([.][a-z0-9]([-a-z0-9]*[a-z0-9])?)*$')"
+	Group string `json:"group"`
+
+	// Resource is the resource of the referent.
+	//
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:XValidation:message="resource must be a lowercase plural resource name, not a kind",rule="self.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$')"
+	Resource string `json:"resource"`
+
+	// Name is the name of the referent. When unspecified, this policy
+	// refers to all resources of the specified Group and Kind in the local
+	// namespace.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name,omitempty"`
+
+	// NamePrefix allows all referents whose name starts with the prefix.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	NamePrefix string `json:"namePrefix,omitempty"`
+
+	// Selector allows all referents with matching labels. Access follows
+	// label changes on the referents.
+	//
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ReferenceGrantStatus describes the current state of a ReferenceGrant.
+type ReferenceGrantStatus struct {
+	// ObservedGeneration is the most recent generation observed by the
+	// controller.
+	//
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// AuthorizedReferences lists references that are currently authorized by
+	// this grant across all of its patterns. The list is limited to 32
+	// entries, AuthorizedReferenceCount holds the total number of references.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	AuthorizedReferences []AuthorizedReference `json:"authorizedReferences,omitempty"`
+
+	// AuthorizedReferenceCount is the total number of references that are
+	// currently authorized by this grant across all of its patterns.
+	//
+	// +optional
+	AuthorizedReferenceCount int32 `json:"authorizedReferenceCount,omitempty"`
+
+	// Consumers lists the names of the ClusterReferenceConsumers that have
+	// been granted access through this grant. The list is limited to 32
+	// entries.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	Consumers []string `json:"consumers,omitempty"`
+
+	// DeniedReferenceCount is the number of references following the
+	// patterns of this grant to resources in this namespace that were denied
+	// because no ReferenceGrant allowed them.
+	//
+	// +optional
+	DeniedReferenceCount int32 `json:"deniedReferenceCount,omitempty"`
+
+	// Patterns breaks the usage of this grant down by ClusterReferencePattern.
+	// The list is limited to 32 entries.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=32
+	Patterns []ReferenceGrantPatternStatus `json:"patterns,omitempty"`
+
+	// Conditions describe the current state of the ReferenceGrant.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +kubebuilder:validation:MaxItems=8
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ReferenceGrantPatternStatus describes the usage of a ReferenceGrant by a
+// single ClusterReferencePattern.
+type ReferenceGrantPatternStatus struct {
+	// Name is the name of the ClusterReferencePattern.
+	Name string `json:"name"`
+
+	// AuthorizedReferenceCount is the number of references following the
+	// pattern that are currently authorized by this grant.
+	//
+	// +optional
+	AuthorizedReferenceCount int32 `json:"authorizedReferenceCount,omitempty"`
+
+	// Consumers lists the names of the ClusterReferenceConsumers of the
+	// pattern that have been granted access through this grant. The list is
+	// limited to 32 entries.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	Consumers []string `json:"consumers,omitempty"`
+
+	// DeniedReferenceCount is the number of references following the pattern
+	// to resources in this namespace that were denied because no
+	// ReferenceGrant allowed them.
+	//
+	// +optional
+	DeniedReferenceCount int32 `json:"deniedReferenceCount,omitempty"`
+}
+
+// AuthorizedReference describes a single reference that is authorized by a
+// ReferenceGrant.
+type AuthorizedReference struct {
+	// Pattern is the name of the ClusterReferencePattern the reference
+	// follows.
+	//
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+
+	// Referrer identifies the object the reference comes from.
+	Referrer ReferrerRef `json:"referrer"`
+
+	// Group is the group of the referenced resource.
+	Group string `json:"group"`
+
+	// Resource is the resource of the referenced resource.
+	Resource string `json:"resource"`
+
+	// Name is the name of the referenced resource.
+	Name string `json:"name"`
+}
+
+// ReferrerRef identifies the object a reference comes from.
+type ReferrerRef struct {
+	// Group is the group of the referrer.
+	Group string `json:"group"`
+
+	// Resource is the resource of the referrer.
+	Resource string `json:"resource"`
+
+	// Namespace is the namespace of the referrer.
+	//
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the referrer.
+	Name string `json:"name"`
+}
@@ -14,18 +14,25 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-echo "Generating v1alpha1 CRDs and deepcopy"
+echo "Generating CRDs and deepcopy"
 go run sigs.k8s.io/controller-tools/cmd/controller-gen \
         object:headerFile=./hack/boilerplate/boilerplate.generatego.txt \
         crd:crdVersions=v1 \
         output:crd:artifacts:config=config/crd \
-        paths=./apis/v1alpha1
+        paths=./apis/...
+
+echo "Generating webhook configuration"
+go run sigs.k8s.io/controller-tools/cmd/controller-gen \
+        webhook \
+        output:webhook:artifacts:config=config/webhook \
+        paths=./pkg/controller
 
 readonly APIS_PKG=sigs.k8s.io/referencegrant-poc
-readonly VERSION=v1alpha1
 
-echo "Generating ${VERSION} register at ${APIS_PKG}/apis/${VERSION}"
-go run k8s.io/code-generator/cmd/register-gen \
-    --input-dirs "./apis/v1alpha1" \
-    --output-package "./apis/v1alpha1" \
-    --go-header-file ./hack/boilerplate/boilerplate.generatego.txt
+for VERSION in v1alpha1 v1beta1; do
+    echo "Generating ${VERSION} register at ${APIS_PKG}/apis/${VERSION}"
+    go run k8s.io/code-generator/cmd/register-gen \
+        --input-dirs "./apis/${VERSION}" \
+        --output-package "./apis/${VERSION}" \
+        --go-header-file ./hack/boilerplate/boilerplate.generatego.txt
+done
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// celCostLimit bounds the cost of evaluating a reference expression
+	// against a single referrer.
+	celCostLimit = 1000000
+)
+
+var (
+	referenceEnvOnce sync.Once
+	referenceEnv     *cel.Env
+	referenceEnvErr  error
+)
+
+// getReferenceEnv returns the CEL environment reference expressions are
+// compiled in. The referrer is available as the object variable.
+func getReferenceEnv() (*cel.Env, error) {
+	referenceEnvOnce.Do(func() {
+		referenceEnv, referenceEnvErr = cel.NewEnv(cel.Variable("object", cel.DynType))
+	})
+	return referenceEnv, referenceEnvErr
+}
+
+// compileExpression parses and type-checks a reference expression. The
+// expression must return a list, its items are checked when it is evaluated.
+func compileExpression(expression string) (cel.Program, error) {
+	env, err := getReferenceEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	out := ast.OutputType()
+	if out.String() != cel.DynType.String() && !cel.ListType(cel.DynType).IsAssignableType(out) {
+		return nil, fmt.Errorf("expression must return a list of references but returns %s", out)
+	}
+
+	return env.Program(ast, cel.CostLimit(celCostLimit))
+}
+
+// evalExpression evaluates a compiled reference expression against the
+// referrer and returns the result as plain Go values.
+func evalExpression(prg cel.Program, object map[string]interface{}) (reflect.Value, error) {
+	val, _, err := prg.Eval(map[string]interface{}{"object": object})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	native, err := val.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return reflect.ValueOf(native.(*structpb.Value).AsInterface()), nil
+}
+
+// programCache holds the compiled expressions of every pattern so they are
+// only compiled again when the pattern changes.
+type programCache struct {
+	mu       sync.Mutex
+	programs map[string]map[string]cel.Program
+}
+
+func newProgramCache() *programCache {
+	return &programCache{programs: map[string]map[string]cel.Program{}}
+}
+
+// compile returns the compiled programs for the expressions of the named
+// pattern. Programs for expressions the pattern no longer has are dropped.
+func (pc *programCache) compile(patternName string, expressions []string) (map[string]cel.Program, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	prev := pc.programs[patternName]
+	programs := map[string]cel.Program{}
+	for _, expr := range expressions {
+		if prg, ok := prev[expr]; ok {
+			programs[expr] = prg
+			continue
+		}
+		prg, err := compileExpression(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q: %w", expr, err)
+		}
+		programs[expr] = prg
+	}
+	pc.programs[patternName] = programs
+
+	return programs, nil
+}
+
+// release drops the compiled programs of the named pattern.
+func (pc *programCache) release(patternName string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	delete(pc.programs, patternName)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+)
+
+type ClusterReferenceGrantHandler struct {
+	c *Controller
+}
+
+func NewClusterReferenceGrantHandler(c *Controller) *ClusterReferenceGrantHandler {
+	return &ClusterReferenceGrantHandler{c: c}
+}
+
+func (h *ClusterReferenceGrantHandler) Create(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForCRG(ctx, e.Object, q)
+}
+
+// Update queues the patterns of both the old and the new ClusterReferenceGrant.
+// Patterns the grant no longer covers, or that only used it in namespaces its
+// TargetNamespaceSelector no longer selects, must drop what it allowed.
+func (h *ClusterReferenceGrantHandler) Update(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForCRG(ctx, e.ObjectNew, q)
+	h.queuePatternsForCRG(ctx, e.ObjectOld, q)
+}
+
+func (h *ClusterReferenceGrantHandler) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForCRG(ctx, e.Object, q)
+}
+
+func (h *ClusterReferenceGrantHandler) Generic(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForCRG(ctx, e.Object, q)
+}
+
+func (h *ClusterReferenceGrantHandler) queuePatternsForCRG(ctx context.Context, obj client.Object, q workqueue.RateLimitingInterface) {
+	crg := obj.(*v1a1.ClusterReferenceGrant)
+	patternNames, err := h.c.grantPatternNames(ctx, clusterGrantView(crg))
+	if err != nil {
+		h.c.log.Error(err, "error finding ClusterReferencePatterns of ClusterReferenceGrant", "name", crg.Name)
+	}
+	for pn := range patternNames {
+		q.AddRateLimited(reconcile.Request{NamespacedName: types.NamespacedName{Name: pn}})
+	}
+}
+
+// clusterGrantView returns a ReferenceGrant without a namespace that shares
+// the patterns, From, To and consumers of the ClusterReferenceGrant, so that
+// both kinds of grants are matched the same way.
+func clusterGrantView(crg *v1a1.ClusterReferenceGrant) *v1a1.ReferenceGrant {
+	return &v1a1.ReferenceGrant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       crg.Name,
+			Generation: crg.Generation,
+		},
+		PatternName:     crg.PatternName,
+		PatternNames:    crg.PatternNames,
+		PatternSelector: crg.PatternSelector,
+		From:            crg.From,
+		To:              crg.To,
+		ConsumerNames:   crg.ConsumerNames,
+	}
+}
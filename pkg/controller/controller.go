@@ -17,47 +17,90 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 
 	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+	v1b1 "sigs.k8s.io/referencegrant-poc/apis/v1beta1"
 
 	"github.com/go-logr/logr"
+	"github.com/google/cel-go/cel"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/util/jsonpath"
 	"k8s.io/klog/v2/klogr"
 	"k8s.io/klog/v2/textlogger"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 const (
 	labelKeyPatternName = "reference.authorization.k8s.io/pattern-name"
+	// labelKeyConsumerUID holds the UID rather than the name of the
+	// consumer, since names may be too long for a label value.
+	labelKeyConsumerUID = "reference.authorization.k8s.io/consumer-uid"
+
+	// finalizerRBACCleanup ensures that generated RBAC is revoked before a
+	// ClusterReferencePattern is removed.
+	finalizerRBACCleanup = "reference.authorization.k8s.io/rbac-cleanup"
 )
 
 type Controller struct {
-	dClient  *dynamic.DynamicClient
-	crClient client.Client
-	log      logr.Logger
+	dClient   *dynamic.DynamicClient
+	crClient  client.Client
+	apiReader client.Reader
+	mapper    meta.RESTMapper
+	kinds     *kindMapper
+	programs  *programCache
+	referrers *referrerInformers
+	targets   *targetInformers
+	// referrerEvents receives an event for every pattern affected by a
+	// change to one of its referrers.
+	referrerEvents chan event.GenericEvent
+	// allowedVerbs is the ceiling for the verbs a pattern may grant.
+	allowedVerbs sets.Set[string]
+	log          logr.Logger
+}
+
+// Options configures the Controller.
+type Options struct {
+	// EnableWebhooks enables the validating admission and conversion webhooks.
+	EnableWebhooks bool
+	// WebhookCertDir is the directory containing the webhook serving
+	// certificate, the controller-runtime default is used when empty.
+	WebhookCertDir string
+	// AllowedVerbs are the verbs ClusterReferencePatterns may grant on
+	// referenced resources.
+	AllowedVerbs []string
 }
 
-func NewController() *Controller {
+func NewController(opts Options) *Controller {
 	lConfig := textlogger.NewConfig()
 
 	c := &Controller{
-		log: textlogger.NewLogger(lConfig),
+		referrerEvents: make(chan event.GenericEvent),
+		allowedVerbs:   sets.New(opts.AllowedVerbs...),
+		log:            textlogger.NewLogger(lConfig),
 	}
 	ctrl.SetLogger(klogr.New())
 
@@ -66,6 +109,7 @@ func NewController() *Controller {
 	kConfig := ctrl.GetConfigOrDie()
 	scheme := scheme.Scheme
 	v1a1.AddToScheme(scheme)
+	v1b1.AddToScheme(scheme)
 
 	dClient, err := dynamic.NewForConfig(kConfig)
 	if err != nil {
@@ -73,22 +117,63 @@ func NewController() *Controller {
 		os.Exit(1)
 	}
 
+	dcClient, err := discovery.NewDiscoveryClientForConfig(kConfig)
+	if err != nil {
+		c.log.Error(err, "could not create Discovery client")
+		os.Exit(1)
+	}
+
+	mClient, err := metadata.NewForConfig(kConfig)
+	if err != nil {
+		c.log.Error(err, "could not create Metadata client")
+		os.Exit(1)
+	}
+
 	c.dClient = dClient
+	c.kinds = newKindMapper(dcClient)
+	c.programs = newProgramCache()
+	c.referrers = newReferrerInformers(dClient, c.referrerEvents, c.log)
+	c.targets = newTargetInformers(mClient, c.referrerEvents, c.log)
 
-	manager, err := ctrl.NewManager(kConfig, ctrl.Options{Scheme: scheme})
+	// Only RBAC resources generated by this controller are cached and watched.
+	managedSelector, err := labels.Parse(labelKeyPatternName)
+	if err != nil {
+		c.log.Error(err, "could not create label selector for managed RBAC")
+		os.Exit(1)
+	}
+	cacheOpts := cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&rbacv1.Role{}:               {Label: managedSelector},
+			&rbacv1.RoleBinding{}:        {Label: managedSelector},
+			&rbacv1.ClusterRole{}:        {Label: managedSelector},
+			&rbacv1.ClusterRoleBinding{}: {Label: managedSelector},
+		},
+	}
+
+	webhookServer := webhook.NewServer(webhook.Options{CertDir: opts.WebhookCertDir})
+
+	manager, err := ctrl.NewManager(kConfig, ctrl.Options{Scheme: scheme, Cache: cacheOpts, WebhookServer: webhookServer})
 	if err != nil {
 		c.log.Error(err, "could not create manager")
 		os.Exit(1)
 	}
 
 	c.crClient = manager.GetClient()
+	c.apiReader = manager.GetAPIReader()
+	c.mapper = manager.GetRESTMapper()
 
-	// TODO: Add selective ClusterRole and RoleBinding watchers here
 	err = ctrl.NewControllerManagedBy(manager).
 		Named("referencegrant-poc").
 		Watches(&v1a1.ClusterReferenceConsumer{}, NewClusterReferenceConsumerHandler(c)).
 		Watches(&v1a1.ClusterReferencePattern{}, NewClusterReferencePatternHandler(c)).
 		Watches(&v1a1.ReferenceGrant{}, NewReferenceGrantHandler(c)).
+		Watches(&v1a1.ClusterReferenceGrant{}, NewClusterReferenceGrantHandler(c)).
+		WatchesRawSource(&source.Channel{Source: c.referrerEvents}, NewReferrerHandler(c)).
+		Watches(&corev1.Namespace{}, NewNamespaceHandler(c)).
+		Watches(&rbacv1.Role{}, NewManagedRBACHandler(c)).
+		Watches(&rbacv1.RoleBinding{}, NewManagedRBACHandler(c)).
+		Watches(&rbacv1.ClusterRole{}, NewManagedRBACHandler(c)).
+		Watches(&rbacv1.ClusterRoleBinding{}, NewManagedRBACHandler(c)).
 		Complete(c)
 
 	if err != nil {
@@ -96,6 +181,45 @@ func NewController() *Controller {
 		os.Exit(1)
 	}
 
+	if opts.EnableWebhooks {
+		// v1beta1 is the conversion hub, registering it serves the
+		// conversion webhook for all versions. Validation happens on the
+		// v1alpha1 webhooks, the API server converts v1beta1 requests.
+		for _, hub := range []client.Object{&v1b1.ClusterReferencePattern{}, &v1b1.ClusterReferenceConsumer{}, &v1b1.ReferenceGrant{}, &v1b1.ClusterReferenceGrant{}} {
+			if err := ctrl.NewWebhookManagedBy(manager).For(hub).Complete(); err != nil {
+				c.log.Error(err, "could not setup conversion webhook", "type", fmt.Sprintf("%T", hub))
+				os.Exit(1)
+			}
+		}
+
+		err = ctrl.NewWebhookManagedBy(manager).
+			For(&v1a1.ClusterReferencePattern{}).
+			WithValidator(NewClusterReferencePatternValidator(c)).
+			Complete()
+		if err != nil {
+			c.log.Error(err, "could not setup ClusterReferencePattern webhook")
+			os.Exit(1)
+		}
+
+		err = ctrl.NewWebhookManagedBy(manager).
+			For(&v1a1.ReferenceGrant{}).
+			WithValidator(NewReferenceGrantValidator(c)).
+			Complete()
+		if err != nil {
+			c.log.Error(err, "could not setup ReferenceGrant webhook")
+			os.Exit(1)
+		}
+
+		err = ctrl.NewWebhookManagedBy(manager).
+			For(&v1a1.ClusterReferenceGrant{}).
+			WithValidator(NewClusterReferenceGrantValidator(c)).
+			Complete()
+		if err != nil {
+			c.log.Error(err, "could not setup ClusterReferenceGrant webhook")
+			os.Exit(1)
+		}
+	}
+
 	if err := manager.Start(ctrl.SetupSignalHandler()); err != nil {
 		c.log.Error(err, "could not start manager")
 		os.Exit(1)
@@ -111,131 +235,980 @@ func (c *Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	// cluster-scoped resources and will fail without it being set.
 	req.NamespacedName.Namespace = "default"
 
+	crcList := &v1a1.ClusterReferenceConsumerList{}
+	err := c.crClient.List(ctx, crcList)
+	if err != nil {
+		c.log.Error(err, "could not list ClusterReferenceConsumers")
+		return ctrl.Result{}, err
+	}
+
+	rgList := &v1a1.ReferenceGrantList{}
+	err = c.crClient.List(ctx, rgList)
+	if err != nil {
+		c.log.Error(err, "could not list ReferenceGrants")
+		return ctrl.Result{}, err
+	}
+
+	crgList := &v1a1.ClusterReferenceGrantList{}
+	err = c.crClient.List(ctx, crgList)
+	if err != nil {
+		c.log.Error(err, "could not list ClusterReferenceGrants")
+		return ctrl.Result{}, err
+	}
+
 	crp := &v1a1.ClusterReferencePattern{}
-	err := c.crClient.Get(ctx, req.NamespacedName, crp)
+	err = c.crClient.Get(ctx, req.NamespacedName, crp)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			// TODO: Some form of cleanup is needed here
+			// The finalizer should have handled this already, but RBAC may
+			// still be left behind if the finalizer was removed by someone
+			// else.
+			c.releasePattern(req.NamespacedName.Name)
+			err = c.cleanupRBAC(ctx, req.NamespacedName.Name)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, c.updateDependentStatuses(ctx, req.NamespacedName.Name, nil, crcList, rgList, crgList, nil)
 		}
 		c.log.Error(err, "error fetching ClusterReferencePattern")
 		return ctrl.Result{}, err
 	}
 
-	// TODO: Have informers for each target resource of a ClusterReferencePattern
-	targetGVR := schema.GroupVersionResource{Group: crp.Group, Version: crp.Version, Resource: crp.Resource}
-	targetList, err := c.dClient.Resource(targetGVR).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		c.log.Error(err, "failed to list target for ClusterReferencePattern", targetGVR)
-		return ctrl.Result{}, err
+	if !crp.DeletionTimestamp.IsZero() {
+		c.releasePattern(crp.Name)
+		err = c.cleanupRBAC(ctx, crp.Name)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if controllerutil.RemoveFinalizer(crp, finalizerRBACCleanup) {
+			err = c.crClient.Update(ctx, crp)
+			if err != nil {
+				c.log.Error(err, "error removing finalizer from ClusterReferencePattern")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, c.updateDependentStatuses(ctx, crp.Name, nil, crcList, rgList, crgList, nil)
+	}
+
+	if controllerutil.AddFinalizer(crp, finalizerRBACCleanup) {
+		err = c.crClient.Update(ctx, crp)
+		if err != nil {
+			c.log.Error(err, "error adding finalizer to ClusterReferencePattern")
+			return ctrl.Result{}, err
+		}
 	}
 
-	refs := c.getReferences(ctx, targetList, crp.Path)
+	status := crp.Status.DeepCopy()
+	status.ObservedGeneration = crp.Generation
 
-	crcList := &v1a1.ClusterReferenceConsumerList{}
-	err = c.crClient.List(ctx, crcList)
+	results, reconcileErr := c.reconcilePattern(ctx, crp, status, crcList, rgList, crgList)
+	// No ReferenceGrant can allow references to cluster-scoped resources, so
+	// their denials are reported on the pattern instead.
+	status.DeniedClusterScopedReferenceCount = 0
+	if results != nil {
+		status.DeniedClusterScopedReferenceCount = int32(results.denied[""].Len())
+	}
+
+	err = c.updatePatternStatus(ctx, crp, status)
+	if err == nil {
+		err = c.updateDependentStatuses(ctx, crp.Name, crp, crcList, rgList, crgList, results)
+	}
+
+	if isNotSynced(reconcileErr) {
+		// Informers notify the pattern once they have synced, requeueing
+		// only covers informers that keep failing.
+		return ctrl.Result{RequeueAfter: informerRetryInterval}, err
+	}
+	if reconcileErr != nil {
+		return ctrl.Result{}, reconcileErr
+	}
+	return ctrl.Result{}, err
+}
+
+// releasePattern stops tracking the resources and programs of a pattern that
+// is deleted or can not be evaluated.
+func (c *Controller) releasePattern(patternName string) {
+	c.referrers.release(patternName)
+	c.programs.release(patternName)
+	c.targets.release(patternName)
+}
+
+// reconcilePattern generates RBAC for the ClusterReferencePattern and records
+// the outcome as conditions in the provided status. The authorization results
+// are nil if references could not be evaluated.
+func (c *Controller) reconcilePattern(ctx context.Context, crp *v1a1.ClusterReferencePattern, status *v1a1.ClusterReferencePatternStatus, crcList *v1a1.ClusterReferenceConsumerList, rgList *v1a1.ReferenceGrantList, crgList *v1a1.ClusterReferenceGrantList) (*authorizationResults, error) {
+	gen := crp.Generation
+
+	paths, err := c.parsePaths(crp)
 	if err != nil {
-		c.log.Error(err, "could not list ClusterReferenceConsumers")
-		return ctrl.Result{}, err
+		c.log.Error(err, "error parsing JSON Path")
+		msg := err.Error()
+		setCondition(&status.Conditions, gen, v1a1.ConditionAccepted, metav1.ConditionFalse, v1a1.ReasonInvalidPath, msg)
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionUnknown, v1a1.ReasonPending, "ClusterReferencePattern has not been accepted")
+		setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, "ClusterReferencePattern has not been accepted")
+		setUnresolvedReferences(status, crp, nil)
+		setMalformedReferences(status, crp, nil)
+		// Access granted for the previous paths must not outlive them.
+		// Retrying will not help until the pattern itself changes, so only
+		// a failed cleanup is returned.
+		c.releasePattern(crp.Name)
+		return nil, c.cleanupRBAC(ctx, crp.Name)
+	}
+
+	if disallowed := c.disallowedVerbs(crp); len(disallowed) > 0 {
+		msg := fmt.Sprintf("Verbs %s are not allowed by the controller", strings.Join(disallowed, ", "))
+		setCondition(&status.Conditions, gen, v1a1.ConditionAccepted, metav1.ConditionFalse, v1a1.ReasonVerbsNotAllowed, msg)
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionUnknown, v1a1.ReasonPending, "ClusterReferencePattern has not been accepted")
+		setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, "ClusterReferencePattern has not been accepted")
+		setUnresolvedReferences(status, crp, nil)
+		setMalformedReferences(status, crp, nil)
+		// RBAC written before the ceiling was lowered must not outlive it.
+		c.releasePattern(crp.Name)
+		return nil, c.cleanupRBAC(ctx, crp.Name)
+	}
+	setCondition(&status.Conditions, gen, v1a1.ConditionAccepted, metav1.ConditionTrue, v1a1.ReasonAccepted, "")
+
+	targetGVR := schema.GroupVersionResource{Group: crp.Group, Version: crp.Version, Resource: crp.Resource}
+	_, err = c.mapper.KindFor(targetGVR)
+	var targets []*unstructured.Unstructured
+	if err == nil {
+		targets, err = c.referrers.list(crp.Name, targetGVR)
+	} else {
+		c.referrers.release(crp.Name)
+	}
+	if isNotSynced(err) {
+		c.log.Info("Referrer informer has not synced yet", "resource", targetGVR)
+		msg := fmt.Sprintf("Referrer resource %s is still being listed", targetGVR)
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonReferrerNotSynced, msg)
+		setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, "Referrer resource has not been listed yet")
+		return nil, err
+	} else if err != nil {
+		c.log.Error(err, "failed to list target for ClusterReferencePattern", "resource", targetGVR)
+		msg := fmt.Sprintf("Referrer resource %s could not be listed: %v", targetGVR, err)
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonReferrerNotFound, msg)
+		setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, "Referrer resource could not be listed")
+		setUnresolvedReferences(status, crp, nil)
+		setMalformedReferences(status, crp, nil)
+		return nil, err
+	}
+
+	// References with an unknown kind or that can not be parsed are left
+	// out, the remaining ones are still programmed.
+	found := c.getReferences(ctx, crp, targets, paths)
+	setUnresolvedReferences(status, crp, found.unresolved)
+	setMalformedReferences(status, crp, found.malformed)
+	if len(found.malformed) > 0 {
+		msg := fmt.Sprintf("%d matches of the paths are not valid references", len(found.malformed))
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonMalformedReferences, msg)
+	} else if len(found.unresolved) > 0 {
+		msg := fmt.Sprintf("%d references could not be resolved to a resource", len(found.unresolved))
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonUnresolvedReferences, msg)
+	} else {
+		setCondition(&status.Conditions, gen, v1a1.ConditionResolvedRefs, metav1.ConditionTrue, v1a1.ReasonResolvedRefs, "")
+	}
+
+	results, err := c.reconcileReferences(ctx, crp, found, crcList, rgList, crgList)
+	if isNotSynced(err) {
+		setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, "Target resources selected by grants have not been listed yet")
+		return nil, err
+	} else if err != nil {
+		setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonRBACFailed, err.Error())
+		return results, err
+	}
+	setCondition(&status.Conditions, gen, v1a1.ConditionProgrammed, metav1.ConditionTrue, v1a1.ReasonProgrammed, "")
+
+	return results, nil
+}
+
+// reconcileReferences authorizes the references and reconciles the resulting
+// RBAC.
+func (c *Controller) reconcileReferences(ctx context.Context, crp *v1a1.ClusterReferencePattern, found *foundReferences, crcList *v1a1.ClusterReferenceConsumerList, rgList *v1a1.ReferenceGrantList, crgList *v1a1.ClusterReferenceGrantList) (*authorizationResults, error) {
+	grants := c.getGrants(ctx, crp, rgList, crgList)
+	// Without the labels of the targets, grants selecting them by labels
+	// would wrongly revoke access.
+	if err := c.ensureTargetInformers(crp, grants); isNotSynced(err) {
+		return nil, err
 	}
 
-	subjects := c.getSubjects(ctx, crcList, crp.Name)
+	consumers := c.getConsumers(ctx, crcList, crp.Name)
+	results := newAuthorizationResults()
 
-	// TODO: Don't just blindly trust references, ensure ReferenceGrant allows them first
-	err = c.reconcileRBAC(ctx, crp, subjects, refs)
+	// BaselineGrants and ReferenceGrants restricted to specific consumers
+	// allow every consumer a different set of references, so each consumer
+	// gets its own Roles and RoleBindings.
+	consumerUIDs := sets.New[string]()
+	for i := range consumers {
+		crc := &consumers[i]
+		consumerUIDs.Insert(string(crc.UID))
+		authorizedRefs := c.getAuthorizedReferences(ctx, grants, crp, crc, found, results)
+		err := c.reconcileRBAC(ctx, crp, crc, authorizedRefs)
+		if err != nil {
+			c.log.Error(err, "error reconciling RBAC", "consumer", crc.Name)
+			return results, err
+		}
+	}
+
+	// RBAC of consumers that no longer implement the pattern is revoked.
+	return results, c.deleteRBAC(ctx, crp.Name, consumerUIDs)
+}
+
+// updateDependentStatuses updates the status of all consumers and grants of
+// the named pattern. The pattern is nil if it does not exist.
+func (c *Controller) updateDependentStatuses(ctx context.Context, patternName string, crp *v1a1.ClusterReferencePattern, crcList *v1a1.ClusterReferenceConsumerList, rgList *v1a1.ReferenceGrantList, crgList *v1a1.ClusterReferenceGrantList, results *authorizationResults) error {
+	err := c.updateConsumerStatuses(ctx, patternName, crp, crcList)
 	if err != nil {
-		c.log.Error(err, "error reconciling RBAC")
-		return ctrl.Result{}, err
+		return err
+	}
+	return c.updateGrantStatuses(ctx, patternName, crp, rgList, crgList, results)
+}
+
+// ensureTargetInformers makes sure the labels of every target resource that
+// the grants select by are cached. The returned error wraps
+// errInformerNotSynced while they are still being listed. Other failures are
+// only logged, grants that depend on labels that are not available do not
+// allow anything.
+func (c *Controller) ensureTargetInformers(crp *v1a1.ClusterReferencePattern, grantsByNamespace map[string][]v1a1.ReferenceGrant) error {
+	grs := sets.New[schema.GroupResource]()
+	for _, grants := range grantsByNamespace {
+		for _, rg := range grants {
+			for _, to := range rg.To {
+				if to.Selector != nil {
+					grs.Insert(schema.GroupResource{Group: to.Group, Resource: to.Resource})
+				}
+			}
+		}
 	}
 
-	return ctrl.Result{}, nil
+	gvrs := []schema.GroupVersionResource{}
+	for gr := range grs {
+		gvr, err := c.kinds.versionedResourceFor(gr)
+		if err != nil {
+			c.log.Info("Could not resolve target resource selected by labels", "resource", gr, "error", err)
+			continue
+		}
+		gvrs = append(gvrs, gvr)
+	}
+
+	err := c.targets.ensure(crp.Name, gvrs)
+	if err != nil && !isNotSynced(err) {
+		c.log.Error(err, "error starting target informers", "pattern", crp.Name)
+	}
+	return err
 }
 
-func (c *Controller) getSubjects(ctx context.Context, list *v1a1.ClusterReferenceConsumerList, patternName string) []rbacv1.Subject {
-	subjects := []rbacv1.Subject{}
+// getConsumers returns all consumers of the pattern.
+func (c *Controller) getConsumers(ctx context.Context, list *v1a1.ClusterReferenceConsumerList, patternName string) []v1a1.ClusterReferenceConsumer {
+	consumers := []v1a1.ClusterReferenceConsumer{}
 
 	for _, crc := range list.Items {
-		match := false
-		for _, pn := range crc.PatternNames {
-			if pn == patternName {
-				match = true
-				break
-			}
+		if consumerImplements(&crc, patternName) {
+			consumers = append(consumers, crc)
 		}
+	}
 
-		if match {
-			// TODO: Dedupe
-			subjects = append(subjects, crc.Subject)
+	return consumers
+}
+
+// consumerBaseline returns the BaselineGrant of the consumer, applying the
+// default.
+func consumerBaseline(crc *v1a1.ClusterReferenceConsumer) v1a1.BaselineGrantType {
+	if crc.BaselineGrant == "" {
+		return v1a1.BaselineGrantSameNamespace
+	}
+	return crc.BaselineGrant
+}
+
+// grantTrustsConsumer returns true if the grant is not restricted to
+// specific consumers or lists the named consumer.
+func grantTrustsConsumer(rg *v1a1.ReferenceGrant, consumerName string) bool {
+	if len(rg.ConsumerNames) == 0 {
+		return true
+	}
+	for _, cn := range rg.ConsumerNames {
+		if cn == consumerName {
+			return true
 		}
 	}
+	return false
+}
 
-	return subjects
+// consumerImplements returns true if the consumer lists the named pattern.
+func consumerImplements(crc *v1a1.ClusterReferenceConsumer, patternName string) bool {
+	for _, pn := range crc.PatternNames {
+		if pn == patternName {
+			return true
+		}
+	}
+	return false
 }
 
+// grantAppliesTo returns true if the grant allows references following the
+// named pattern. The pattern is nil if it does not exist, in which case it can
+// not be selected by its labels.
+func grantAppliesTo(rg *v1a1.ReferenceGrant, patternName string, crp *v1a1.ClusterReferencePattern) bool {
+	if rg.PatternName != "" {
+		return rg.PatternName == patternName
+	}
+	for _, pn := range rg.PatternNames {
+		if pn == patternName {
+			return true
+		}
+	}
+	if rg.PatternSelector == nil || crp == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(rg.PatternSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(crp.Labels))
+}
+
+// grantPatternNames returns the names of all patterns the grant applies to.
+// Patterns listed by name are included whether they exist or not.
+func (c *Controller) grantPatternNames(ctx context.Context, rg *v1a1.ReferenceGrant) (sets.Set[string], error) {
+	names := sets.New[string](rg.PatternNames...)
+	if rg.PatternName != "" {
+		names.Insert(rg.PatternName)
+	}
+	if rg.PatternSelector == nil {
+		return names, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(rg.PatternSelector)
+	if err != nil {
+		return names, err
+	}
+	crpList := &v1a1.ClusterReferencePatternList{}
+	err = c.crClient.List(ctx, crpList, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return names, err
+	}
+	for _, crp := range crpList.Items {
+		names.Insert(crp.Name)
+	}
+	return names, nil
+}
+
+// reference is a single reference from a referrer to a target. ToNamespace is
+// empty if and only if the target is cluster-scoped.
 type reference struct {
 	Group         string
 	Resource      string
 	FromNamespace string
+	FromName      string
 	ToNamespace   string
 	Name          string
 }
 
-func (c *Controller) getReferences(ctx context.Context, list *unstructured.UnstructuredList, path string) []reference {
-	refs := []reference{}
-	for _, item := range list.Items {
-		j := jsonpath.New("test")
-		err := j.Parse(fmt.Sprintf("{%s}", path))
+// unresolvedReference is a reference whose kind could not be mapped to a
+// resource.
+type unresolvedReference struct {
+	Group         string
+	Kind          string
+	FromNamespace string
+	FromName      string
+	Name          string
+	Message       string
+}
+
+// malformedReference is a match of a path that is not a valid reference.
+type malformedReference struct {
+	FromNamespace string
+	FromName      string
+	Path          string
+	Message       string
+}
+
+// referencePath is a parsed ReferencePath. Exactly one of path or program is
+// set.
+type referencePath struct {
+	source  string
+	path    *jsonpath.JSONPath
+	program cel.Program
+	targets []v1a1.ReferenceTarget
+}
+
+// allows returns true if the reference points to one of the targets of the
+// path, or if the path has no targets.
+func (rp *referencePath) allows(ref *reference) bool {
+	if len(rp.targets) == 0 {
+		return true
+	}
+	for _, t := range rp.targets {
+		if t.Group == ref.Group && t.Resource == ref.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultVerbs are granted when a pattern does not specify any verbs.
+var defaultVerbs = []string{"get", "list", "watch"}
+
+// patternVerbs returns the verbs the pattern grants on referenced resources.
+func patternVerbs(crp *v1a1.ClusterReferencePattern) []string {
+	if len(crp.Verbs) == 0 {
+		return defaultVerbs
+	}
+	verbs := sets.New[string]()
+	for _, v := range crp.Verbs {
+		verbs.Insert(string(v))
+	}
+	return sets.List(verbs)
+}
+
+// disallowedVerbs returns the verbs of the pattern that exceed the allowed
+// verbs of the controller.
+func (c *Controller) disallowedVerbs(crp *v1a1.ClusterReferencePattern) []string {
+	disallowed := []string{}
+	for _, v := range patternVerbs(crp) {
+		if !c.allowedVerbs.Has(v) {
+			disallowed = append(disallowed, v)
+		}
+	}
+	return disallowed
+}
+
+// patternPaths returns all paths of the pattern, including the single Path.
+func patternPaths(crp *v1a1.ClusterReferencePattern) []v1a1.ReferencePath {
+	paths := []v1a1.ReferencePath{}
+	if crp.Path != "" {
+		paths = append(paths, v1a1.ReferencePath{Path: crp.Path})
+	}
+	return append(paths, crp.Paths...)
+}
+
+// parsePaths parses all paths of the pattern. Expressions are compiled once
+// and reused until they change.
+func (c *Controller) parsePaths(crp *v1a1.ClusterReferencePattern) ([]referencePath, error) {
+	paths := patternPaths(crp)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no paths specified")
+	}
+
+	expressions := []string{}
+	for _, p := range paths {
+		if p.Expression != "" {
+			expressions = append(expressions, p.Expression)
+		}
+	}
+	programs, err := c.programs.compile(crp.Name, expressions)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := make([]referencePath, 0, len(paths))
+	for _, p := range paths {
+		if p.Expression != "" {
+			parsed = append(parsed, referencePath{source: p.Expression, program: programs[p.Expression], targets: p.Targets})
+			continue
+		}
+		j := jsonpath.New(crp.Name).AllowMissingKeys(true)
+		err := j.Parse(fmt.Sprintf("{%s}", p.Path))
 		if err != nil {
-			c.log.Error(err, "error parsing JSON Path")
+			return nil, fmt.Errorf("invalid path %q: %w", p.Path, err)
 		}
-		results := new(bytes.Buffer)
-		err = j.Execute(results, item.UnstructuredContent())
+		parsed = append(parsed, referencePath{source: p.Path, path: j, targets: p.Targets})
+	}
+
+	return parsed, nil
+}
+
+// foundReferences collects the references found in referrers, along with the
+// ones that could not be resolved or parsed.
+type foundReferences struct {
+	refs       []reference
+	unresolved []unresolvedReference
+	malformed  []malformedReference
+	// referrerLabels holds the labels of every referrer that was evaluated,
+	// so that grants can select referrers by label.
+	referrerLabels map[types.NamespacedName]labels.Set
+
+	seen           sets.Set[reference]
+	seenUnresolved sets.Set[unresolvedReference]
+	seenMalformed  sets.Set[malformedReference]
+}
+
+func newFoundReferences() *foundReferences {
+	return &foundReferences{
+		refs:           []reference{},
+		unresolved:     []unresolvedReference{},
+		malformed:      []malformedReference{},
+		referrerLabels: map[types.NamespacedName]labels.Set{},
+		seen:           sets.New[reference](),
+		seenUnresolved: sets.New[unresolvedReference](),
+		seenMalformed:  sets.New[malformedReference](),
+	}
+}
+
+func (f *foundReferences) add(ref reference) {
+	if !f.seen.Has(ref) {
+		f.seen.Insert(ref)
+		f.refs = append(f.refs, ref)
+	}
+}
+
+func (f *foundReferences) addUnresolved(ur unresolvedReference) {
+	if !f.seenUnresolved.Has(ur) {
+		f.seenUnresolved.Insert(ur)
+		f.unresolved = append(f.unresolved, ur)
+	}
+}
+
+func (f *foundReferences) addMalformed(item *unstructured.Unstructured, path, message string) {
+	mr := malformedReference{
+		FromNamespace: item.GetNamespace(),
+		FromName:      item.GetName(),
+		Path:          path,
+		Message:       message,
+	}
+	if !f.seenMalformed.Has(mr) {
+		f.seenMalformed.Insert(mr)
+		f.malformed = append(f.malformed, mr)
+	}
+}
+
+// getReferences evaluates every path against every item, returning the
+// combined set of references.
+func (c *Controller) getReferences(ctx context.Context, crp *v1a1.ClusterReferencePattern, items []*unstructured.Unstructured, paths []referencePath) *foundReferences {
+	found := newFoundReferences()
+	for _, item := range items {
+		if item.GetNamespace() == "" && crp.ClusterScopedReferrers == v1a1.ClusterScopedReferrerIgnore {
+			continue
+		}
+		key := types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()}
+		found.referrerLabels[key] = labels.Set(item.GetLabels())
+		for i := range paths {
+			c.getPathReferences(item, &paths[i], found)
+		}
+	}
+
+	return found
+}
+
+// getPathReferences adds the references found in the item through a single
+// path. Every match must be a reference object or a list of them.
+func (c *Controller) getPathReferences(item *unstructured.Unstructured, rp *referencePath, found *foundReferences) {
+	if rp.program != nil {
+		result, err := evalExpression(rp.program, item.UnstructuredContent())
 		if err != nil {
-			c.log.Error(err, "error finding results with JSON Path")
+			c.log.Info("Error evaluating expression", "expression", rp.source, "namespace", item.GetNamespace(), "name", item.GetName(), "error", err)
+			found.addMalformed(item, rp.source, err.Error())
+			return
 		}
+		c.parseReferences(item, rp, result, found)
+		return
+	}
 
-		rawRefs := strings.Split(results.String(), " ")
+	results, err := rp.path.FindResults(item.UnstructuredContent())
+	if err != nil {
+		c.log.Info("Error evaluating JSON Path", "path", rp.source, "namespace", item.GetNamespace(), "name", item.GetName(), "error", err)
+		found.addMalformed(item, rp.source, err.Error())
+		return
+	}
 
-		for _, rr := range rawRefs {
-			jr := map[string]string{}
-			err = json.Unmarshal([]byte(rr), &jr)
-			group, hasGroup := jr["group"]
-			if !hasGroup {
-				c.log.Info("Missing group in reference", "ref", jr)
-				continue
-			}
-			resource, hasResource := jr["resource"]
-			if !hasResource {
-				kind, hasKind := jr["kind"]
-				if !hasKind {
-					c.log.Info("Missing kind or resource in reference", "ref", jr)
-					continue
-				}
-				gvr, _ := meta.UnsafeGuessKindToResource(schema.GroupVersionKind{Group: group, Version: "v1", Kind: kind})
-				resource = gvr.Resource
-			}
+	for _, result := range results {
+		for _, v := range result {
+			c.parseReferences(item, rp, v, found)
+		}
+	}
+}
 
-			namespace, hasNamespace := jr["namespace"]
-			if !hasNamespace {
-				namespace = item.GetNamespace()
-			}
+// parseReferences adds the reference described by a single match. Lists are
+// walked so paths may point at a list of references as well as at its items.
+func (c *Controller) parseReferences(item *unstructured.Unstructured, rp *referencePath, v reflect.Value, found *foundReferences) {
+	if !v.IsValid() {
+		return
+	}
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
 
-			name, hasName := jr["name"]
-			if !hasName {
-				c.log.Info("Missing name in reference", "ref", jr)
-				continue
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.parseReferences(item, rp, v.Index(i), found)
+		}
+		return
+	case reflect.Map:
+	default:
+		found.addMalformed(item, rp.source, fmt.Sprintf("expected a reference object but found %s", v.Kind()))
+		return
+	}
+
+	fields := map[string]string{}
+	iter := v.MapRange()
+	for iter.Next() {
+		key, ok := iter.Key().Interface().(string)
+		if !ok {
+			continue
+		}
+		value, ok := iter.Value().Interface().(string)
+		if !ok {
+			switch key {
+			case "group", "resource", "kind", "namespace", "name":
+				found.addMalformed(item, rp.source, fmt.Sprintf("field %q of reference must be a string", key))
+				return
 			}
+			continue
+		}
+		fields[key] = value
+	}
+
+	group, hasGroup := fields["group"]
+	if !hasGroup {
+		found.addMalformed(item, rp.source, "reference is missing group")
+		return
+	}
+	resource, hasResource := fields["resource"]
+	kind, hasKind := fields["kind"]
+	if !hasResource && !hasKind {
+		found.addMalformed(item, rp.source, "reference is missing kind or resource")
+		return
+	}
+	name := fields["name"]
+	if name == "" {
+		found.addMalformed(item, rp.source, "reference is missing name")
+		return
+	}
+	namespace, hasNamespace := fields["namespace"]
+	if !hasNamespace {
+		namespace = item.GetNamespace()
+	}
 
-			refs = append(refs, reference{
+	var clusterScoped bool
+	if !hasResource {
+		var err error
+		resource, clusterScoped, err = c.kinds.resourceFor(schema.GroupKind{Group: group, Kind: kind})
+		if err != nil {
+			c.log.Info("Could not resolve kind in reference", "ref", fields, "error", err)
+			found.addUnresolved(unresolvedReference{
 				Group:         group,
-				Resource:      resource,
+				Kind:          kind,
 				FromNamespace: item.GetNamespace(),
-				ToNamespace:   namespace,
+				FromName:      item.GetName(),
 				Name:          name,
+				Message:       err.Error(),
 			})
+			return
+		}
+	} else {
+		var err error
+		clusterScoped, err = c.kinds.isClusterScoped(schema.GroupResource{Group: group, Resource: resource})
+		if err != nil {
+			// Resources that are not served are treated as namespaced, the
+			// resulting RBAC is harmless until they are.
+			c.log.Info("Could not determine scope of referenced resource", "ref", fields, "error", err)
 		}
 	}
 
-	return refs
+	if clusterScoped {
+		namespace = ""
+	} else if namespace == "" {
+		// Either the referrer is cluster-scoped and there is no namespace
+		// to default to, or the reference sets an empty namespace.
+		found.addMalformed(item, rp.source, "reference to a namespaced resource is missing namespace")
+		return
+	}
+
+	ref := reference{
+		Group:         group,
+		Resource:      resource,
+		FromNamespace: item.GetNamespace(),
+		FromName:      item.GetName(),
+		ToNamespace:   namespace,
+		Name:          name,
+	}
+	if !rp.allows(&ref) {
+		c.log.Info("Reference does not match targets of path", "ref", ref)
+		return
+	}
+	found.add(ref)
+}
+
+// grantUsage records the references a ReferenceGrant authorized and the
+// consumers that were granted access through it.
+type grantUsage struct {
+	refs      sets.Set[reference]
+	consumers sets.Set[string]
+}
+
+// authorizationResults records how references were authorized across all
+// consumers so that it can be reported in ReferenceGrant status.
+type authorizationResults struct {
+	grants map[types.NamespacedName]*grantUsage
+	// denied holds the references that were denied for lack of a matching
+	// ReferenceGrant, keyed by target namespace.
+	denied map[string]sets.Set[reference]
+}
+
+func newAuthorizationResults() *authorizationResults {
+	return &authorizationResults{
+		grants: map[types.NamespacedName]*grantUsage{},
+		denied: map[string]sets.Set[reference]{},
+	}
+}
+
+func (ar *authorizationResults) recordGrant(rg *v1a1.ReferenceGrant, ref reference, consumerName string) {
+	key := types.NamespacedName{Namespace: rg.Namespace, Name: rg.Name}
+	usage, ok := ar.grants[key]
+	if !ok {
+		usage = &grantUsage{refs: sets.New[reference](), consumers: sets.New[string]()}
+		ar.grants[key] = usage
+	}
+	usage.refs.Insert(ref)
+	usage.consumers.Insert(consumerName)
+}
+
+func (ar *authorizationResults) recordDenied(ref reference) {
+	denied, ok := ar.denied[ref.ToNamespace]
+	if !ok {
+		denied = sets.New[reference]()
+		ar.denied[ref.ToNamespace] = denied
+	}
+	denied.Insert(ref)
+}
+
+// getGrants returns the grants for the pattern keyed by the namespace they
+// apply to. ClusterReferenceGrants are expanded into every namespace they
+// select that has no ReferenceGrant for the pattern, namespace owners always
+// take precedence. Expanded grants have no namespace of their own.
+func (c *Controller) getGrants(ctx context.Context, crp *v1a1.ClusterReferencePattern, rgList *v1a1.ReferenceGrantList, crgList *v1a1.ClusterReferenceGrantList) map[string][]v1a1.ReferenceGrant {
+	grantsByNamespace := map[string][]v1a1.ReferenceGrant{}
+	for _, rg := range rgList.Items {
+		if grantAppliesTo(&rg, crp.Name, crp) {
+			grantsByNamespace[rg.Namespace] = append(grantsByNamespace[rg.Namespace], rg)
+		}
+	}
+
+	clusterGrants := []v1a1.ClusterReferenceGrant{}
+	for _, crg := range crgList.Items {
+		if grantAppliesTo(clusterGrantView(&crg), crp.Name, crp) {
+			clusterGrants = append(clusterGrants, crg)
+		}
+	}
+	if len(clusterGrants) == 0 {
+		return grantsByNamespace
+	}
+
+	nsList := &corev1.NamespaceList{}
+	err := c.crClient.List(ctx, nsList)
+	if err != nil {
+		c.log.Error(err, "error listing Namespaces, ClusterReferenceGrants are ignored")
+		return grantsByNamespace
+	}
+
+	for _, crg := range clusterGrants {
+		selector, err := metav1.LabelSelectorAsSelector(&crg.TargetNamespaceSelector)
+		if err != nil {
+			c.log.Error(err, "invalid target namespace selector in ClusterReferenceGrant", "name", crg.Name)
+			continue
+		}
+		view := clusterGrantView(&crg)
+		for _, ns := range nsList.Items {
+			if !selector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+			if hasNamespacedGrant(grantsByNamespace[ns.Name]) {
+				continue
+			}
+			grantsByNamespace[ns.Name] = append(grantsByNamespace[ns.Name], *view)
+		}
+	}
+
+	return grantsByNamespace
+}
+
+// hasNamespacedGrant returns true if any of the grants is a ReferenceGrant
+// rather than an expanded ClusterReferenceGrant.
+func hasNamespacedGrant(grants []v1a1.ReferenceGrant) bool {
+	for _, rg := range grants {
+		if rg.Namespace != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// getAuthorizedReferences filters references down to the ones that are allowed
+// for the consumer. Any reference that is not covered by its BaselineGrant
+// needs a ReferenceGrant for this pattern in the target namespace that trusts
+// the consumer. Every ReferenceGrant that allows a reference is recorded in
+// the results along with the consumer.
+func (c *Controller) getAuthorizedReferences(ctx context.Context, grantsByNamespace map[string][]v1a1.ReferenceGrant, crp *v1a1.ClusterReferencePattern, crc *v1a1.ClusterReferenceConsumer, found *foundReferences, results *authorizationResults) []reference {
+	baseline := consumerBaseline(crc)
+
+	namespaceLabels := map[string]labels.Set{}
+	authorized := []reference{}
+	for _, ref := range found.refs {
+		if baselineAllows(baseline, &ref) {
+			authorized = append(authorized, ref)
+			continue
+		}
+
+		fromLabels, ok := namespaceLabels[ref.FromNamespace]
+		if !ok && ref.FromNamespace != "" {
+			fromLabels = c.getNamespaceLabels(ctx, ref.FromNamespace)
+			namespaceLabels[ref.FromNamespace] = fromLabels
+		}
+
+		referrerLabels := found.referrerLabels[types.NamespacedName{Namespace: ref.FromNamespace, Name: ref.FromName}]
+
+		allowed := false
+		for _, rg := range grantsByNamespace[ref.ToNamespace] {
+			if !grantTrustsConsumer(&rg, crc.Name) {
+				continue
+			}
+			if c.grantAllows(&rg, &ref, fromLabels, referrerLabels) {
+				allowed = true
+				results.recordGrant(&rg, ref, crc.Name)
+			}
+		}
+
+		if allowed {
+			authorized = append(authorized, ref)
+		} else if ref.ToNamespace == "" {
+			c.log.Info("Reference to cluster-scoped resource not allowed by BaselineGrant", "ref", ref, "consumer", crc.Name)
+			results.recordDenied(ref)
+		} else {
+			c.log.Info("Reference not allowed by any ReferenceGrant", "ref", ref, "consumer", crc.Name)
+			results.recordDenied(ref)
+		}
+	}
+
+	return authorized
+}
+
+// baselineAllows returns true if the reference is allowed by the BaselineGrant
+// without the need for a ReferenceGrant.
+func baselineAllows(baseline v1a1.BaselineGrantType, ref *reference) bool {
+	switch baseline {
+	case v1a1.BaselineGrantAll:
+		return true
+	case v1a1.BaselineGrantSameNamespace:
+		return ref.FromNamespace == ref.ToNamespace
+	default:
+		return false
+	}
+}
+
+// fromMatches returns true if the source of the reference is trusted by the
+// ReferenceGrantFrom.
+func (c *Controller) fromMatches(rg *v1a1.ReferenceGrant, from *v1a1.ReferenceGrantFrom, ref *reference, fromLabels, referrerLabels labels.Set) bool {
+	if !c.namespaceMatches(rg, from, ref, fromLabels) {
+		return false
+	}
+	switch {
+	case from.Name != "":
+		return from.Name == ref.FromName
+	case from.Selector != nil:
+		selector, err := metav1.LabelSelectorAsSelector(from.Selector)
+		if err != nil {
+			c.log.Error(err, "invalid referrer selector in ReferenceGrant", "namespace", rg.Namespace, "name", rg.Name)
+			return false
+		}
+		return selector.Matches(referrerLabels)
+	default:
+		return true
+	}
+}
+
+// namespaceMatches returns true if the namespace of the referrer is trusted by
+// the ReferenceGrantFrom.
+func (c *Controller) namespaceMatches(rg *v1a1.ReferenceGrant, from *v1a1.ReferenceGrantFrom, ref *reference, fromLabels labels.Set) bool {
+	// References from cluster-scoped referrers have no namespace and are only
+	// trusted explicitly.
+	if ref.FromNamespace == "" {
+		return from.ClusterScoped
+	}
+	if from.NamespaceSelector != nil {
+		if fromLabels == nil {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(from.NamespaceSelector)
+		if err != nil {
+			c.log.Error(err, "invalid namespace selector in ReferenceGrant", "namespace", rg.Namespace, "name", rg.Name)
+			return false
+		}
+		return selector.Matches(fromLabels)
+	}
+	return from.Namespace == ref.FromNamespace
+}
+
+// toMatches returns true if the target of the reference is allowed by the
+// ReferenceGrantTo, which is expected to already match its group and resource.
+func (c *Controller) toMatches(rg *v1a1.ReferenceGrant, to *v1a1.ReferenceGrantTo, ref *reference) bool {
+	switch {
+	case to.Name != "":
+		return to.Name == ref.Name
+	case to.NamePrefix != "":
+		return strings.HasPrefix(ref.Name, to.NamePrefix)
+	case to.Selector != nil:
+		selector, err := metav1.LabelSelectorAsSelector(to.Selector)
+		if err != nil {
+			c.log.Error(err, "invalid selector in ReferenceGrant", "namespace", rg.Namespace, "name", rg.Name)
+			return false
+		}
+		targetLabels, ok := c.targets.labels(schema.GroupResource{Group: ref.Group, Resource: ref.Resource}, ref.ToNamespace, ref.Name)
+		if !ok {
+			return false
+		}
+		return selector.Matches(labels.Set(targetLabels))
+	default:
+		return true
+	}
+}
+
+// getNamespaceLabels returns the labels of the namespace, or nil if it can not
+// be found.
+func (c *Controller) getNamespaceLabels(ctx context.Context, name string) labels.Set {
+	ns := &corev1.Namespace{}
+	err := c.crClient.Get(ctx, client.ObjectKey{Name: name}, ns)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			c.log.Error(err, "error getting Namespace", "namespace", name)
+		}
+		return nil
+	}
+	return labels.Set(ns.Labels)
+}
+
+// grantAllows returns true if the ReferenceGrant allows the provided reference.
+// The grant is expected to already apply to the target namespace of the
+// reference. fromLabels are the labels of the namespace the reference comes
+// from and referrerLabels are the labels of the referrer itself.
+func (c *Controller) grantAllows(rg *v1a1.ReferenceGrant, ref *reference, fromLabels, referrerLabels labels.Set) bool {
+	fromMatch := false
+	for _, from := range rg.From {
+		if c.fromMatches(rg, &from, ref, fromLabels, referrerLabels) {
+			fromMatch = true
+			break
+		}
+	}
+	if !fromMatch {
+		return false
+	}
+
+	// An empty To list allows references to all resources matching the
+	// pattern.
+	if len(rg.To) == 0 {
+		return true
+	}
+
+	for _, to := range rg.To {
+		if to.Group != ref.Group || to.Resource != ref.Resource {
+			continue
+		}
+		if c.toMatches(rg, &to, ref) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Format: group/resource
@@ -253,20 +1226,46 @@ func splitGroupResource(gr groupResource) (string, string) {
 }
 
 type reconciliationResults struct {
-	rolesCreated        uint
-	rolesUpdated        uint
-	rolesDeleted        uint
-	roleBindingsCreated uint
-	roleBindingsUpdated uint
-	roleBindingsDeleted uint
+	rolesCreated          uint
+	rolesUpdated          uint
+	rolesDeleted          uint
+	rolesUnchanged        uint
+	roleBindingsCreated   uint
+	roleBindingsUpdated   uint
+	roleBindingsDeleted   uint
+	roleBindingsUnchanged uint
+
+	clusterRolesCreated          uint
+	clusterRolesUpdated          uint
+	clusterRolesDeleted          uint
+	clusterRolesUnchanged        uint
+	clusterRoleBindingsCreated   uint
+	clusterRoleBindingsUpdated   uint
+	clusterRoleBindingsDeleted   uint
+	clusterRoleBindingsUnchanged uint
 }
 
-func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferencePattern, subjects []rbacv1.Subject, references []reference) error {
+// reconcileRBAC reconciles the Roles and RoleBindings that grant the consumer
+// access to the targets of the references, at most one of each per
+// ClusterReferencePattern, consumer and namespace.
+func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferencePattern, crc *v1a1.ClusterReferenceConsumer, references []reference) error {
 	var err error
 	rr := reconciliationResults{}
-	listOption := client.MatchingLabels{
+	rbacLabels := map[string]string{
 		labelKeyPatternName: crp.Name,
+		labelKeyConsumerUID: string(crc.UID),
 	}
+	listOption := client.MatchingLabels(rbacLabels)
+
+	// The consumer is the only owner so that the garbage collector revokes
+	// access even if this controller is not running when the consumer is
+	// deleted. Deleting the pattern is covered by its rbac-cleanup finalizer,
+	// a second owner would keep the objects until both are gone.
+	ownerRefs := []metav1.OwnerReference{
+		*metav1.NewControllerRef(crc, v1a1.SchemeGroupVersion.WithKind("ClusterReferenceConsumer")),
+	}
+
+	subjects := normalizeSubjects([]rbacv1.Subject{crc.Subject})
 
 	// TODO: Clean this up + extract it out
 	// Namespace -> Group+Resource -> Resource Name
@@ -286,28 +1285,34 @@ func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferen
 		names.Insert(ref.Name)
 	}
 
-	baseVerbs := []string{"get", "watch", "list"}
+	// Cluster-scoped targets can not be granted through a Role, they get a
+	// ClusterRole instead.
+	clusterResourceNames := namespaceResourceNames[""]
+	delete(namespaceResourceNames, "")
+
+	verbs := patternVerbs(crp)
 	namespaceRoleNames := map[string]string{}
 	desiredRoles := map[string]*rbacv1.Role{}
 
 	for ns, r := range namespaceResourceNames {
 		role := &rbacv1.Role{
 			ObjectMeta: metav1.ObjectMeta{
-				GenerateName: fmt.Sprintf("%s-", crp.Name),
-				Namespace:    ns,
-				Labels:       map[string]string{labelKeyPatternName: crp.Name},
+				GenerateName:    fmt.Sprintf("%s-", crp.Name),
+				Namespace:       ns,
+				Labels:          rbacLabels,
+				OwnerReferences: ownerRefs,
 			},
 		}
 		for gr, nameSet := range r {
 			group, resource := splitGroupResource(gr)
-			names := nameSet.UnsortedList()
 			role.Rules = append(role.Rules, rbacv1.PolicyRule{
 				APIGroups:     []string{group},
 				Resources:     []string{resource},
-				Verbs:         baseVerbs,
-				ResourceNames: names,
+				Verbs:         verbs,
+				ResourceNames: nameSet.UnsortedList(),
 			})
 		}
+		role.Rules = normalizeRules(role.Rules)
 		desiredRoles[ns] = role
 	}
 
@@ -320,32 +1325,37 @@ func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferen
 		return err
 	}
 	for _, role := range roleList.Items {
-		existingRole, isExisting := existingRoles[role.Namespace]
-		desiredRole, isDesired := desiredRoles[role.Namespace]
+		_, isExisting := existingRoles[role.Namespace]
+		_, isDesired := desiredRoles[role.Namespace]
 
-		// We want at most one role per ClusterReferencePattern and Namespace,
-		// anything beyond that should be deleted.
+		// We want at most one role per ClusterReferencePattern, consumer and
+		// Namespace, anything beyond that should be deleted.
 		if !isExisting && isDesired {
-			existingRole = role
-			existingRoles[role.Namespace] = existingRole
-			desiredRole.Name = existingRole.Name
-			desiredRole.GenerateName = ""
+			existingRoles[role.Namespace] = role
 		} else {
 			rolesToDelete = append(rolesToDelete, role)
 		}
 	}
 
-	// TODO: Add proper reconciliation logic to compare desired and existing so
-	// we're not always updating resources even if they don't need to change.
 	for _, dr := range desiredRoles {
-		if dr.Name != "" {
-			c.log.Info("Updating role", "role", dr)
-			err := c.crClient.Update(ctx, dr)
-			if err != nil {
-				c.log.Error(err, "error updating Role")
-				return err
+		if existingRole, ok := existingRoles[dr.Namespace]; ok {
+			dr.Name = existingRole.Name
+			dr.GenerateName = ""
+			if roleNeedsUpdate(&existingRole, dr) {
+				updatedRole := existingRole.DeepCopy()
+				updatedRole.Rules = dr.Rules
+				updatedRole.OwnerReferences = dr.OwnerReferences
+				updatedRole.Labels = mergeLabels(updatedRole.Labels, dr.Labels)
+				c.log.Info("Updating role", "role", updatedRole)
+				err := c.crClient.Update(ctx, updatedRole)
+				if err != nil {
+					c.log.Error(err, "error updating Role")
+					return err
+				}
+				rr.rolesUpdated++
+			} else {
+				rr.rolesUnchanged++
 			}
-			rr.rolesUpdated++
 		} else {
 			c.log.Info("Creating role", "role", dr)
 			err := c.crClient.Create(ctx, dr)
@@ -381,9 +1391,9 @@ func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferen
 		_, isExisting := existingRoleBindings[rb.Namespace]
 		desiredRole, isDesired := desiredRoles[rb.Namespace]
 
-		// We want at most one RoleBinding per ClusterReferencePattern and
-		// Namespace, anything beyond that should be deleted. We also can't
-		// change the RoleRef on an existing RoleBinding.
+		// We want at most one RoleBinding per ClusterReferencePattern,
+		// consumer and Namespace, anything beyond that should be deleted. We
+		// also can't change the RoleRef on an existing RoleBinding.
 		if !isExisting && isDesired && rb.RoleRef.Name == desiredRole.Name {
 			existingRoleBindings[rb.Namespace] = rb
 		} else {
@@ -394,8 +1404,9 @@ func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferen
 	for ns, roleName := range namespaceRoleNames {
 		rb := rbacv1.RoleBinding{
 			ObjectMeta: metav1.ObjectMeta{
-				Namespace: ns,
-				Labels:    map[string]string{labelKeyPatternName: crp.Name},
+				Namespace:       ns,
+				Labels:          rbacLabels,
+				OwnerReferences: ownerRefs,
 			},
 			Subjects: subjects,
 			RoleRef: rbacv1.RoleRef{
@@ -405,14 +1416,21 @@ func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferen
 			},
 		}
 		if existingRB, ok := existingRoleBindings[rb.Namespace]; ok {
-			c.log.Info("Updating RoleBinding", "RoleBinding", rb)
-			rb.Name = existingRB.Name
-			err := c.crClient.Update(ctx, &rb)
-			if err != nil {
-				c.log.Error(err, "error updating RoleBinding")
-				return err
+			if roleBindingNeedsUpdate(&existingRB, &rb) {
+				updatedRB := existingRB.DeepCopy()
+				updatedRB.Subjects = rb.Subjects
+				updatedRB.OwnerReferences = rb.OwnerReferences
+				updatedRB.Labels = mergeLabels(updatedRB.Labels, rb.Labels)
+				c.log.Info("Updating RoleBinding", "RoleBinding", updatedRB)
+				err := c.crClient.Update(ctx, updatedRB)
+				if err != nil {
+					c.log.Error(err, "error updating RoleBinding")
+					return err
+				}
+				rr.roleBindingsUpdated++
+			} else {
+				rr.roleBindingsUnchanged++
 			}
-			rr.roleBindingsUpdated++
 		} else {
 			rb.GenerateName = fmt.Sprintf("%s-", crp.Name)
 			c.log.Info("Creating RoleBinding", "RoleBinding", rb)
@@ -435,7 +1453,267 @@ func (c *Controller) reconcileRBAC(ctx context.Context, crp *v1a1.ClusterReferen
 		rr.roleBindingsDeleted++
 	}
 
-	c.log.Info("Completed RBAC Reconciliation", "Results", fmt.Sprintf("%+v", rr))
+	err = c.reconcileClusterRBAC(ctx, crp, rbacLabels, ownerRefs, subjects, verbs, clusterResourceNames, &rr)
+	if err != nil {
+		return err
+	}
+
+	c.log.Info("Completed RBAC Reconciliation", "consumer", crc.Name, "Results", fmt.Sprintf("%+v", rr))
+
+	return nil
+}
+
+// reconcileClusterRBAC reconciles the ClusterRole and ClusterRoleBinding that
+// grant access to cluster-scoped targets. Like Roles, there is at most one of
+// each per ClusterReferencePattern and consumer, and both are deleted when
+// there are no cluster-scoped references left.
+func (c *Controller) reconcileClusterRBAC(ctx context.Context, crp *v1a1.ClusterReferencePattern, rbacLabels map[string]string, ownerRefs []metav1.OwnerReference, subjects []rbacv1.Subject, verbs []string, resourceNames resourceNamesByGroupAndResource, rr *reconciliationResults) error {
+	listOption := client.MatchingLabels(rbacLabels)
+
+	var desiredRole *rbacv1.ClusterRole
+	if len(resourceNames) > 0 {
+		desiredRole = &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName:    fmt.Sprintf("%s-", crp.Name),
+				Labels:          rbacLabels,
+				OwnerReferences: ownerRefs,
+			},
+		}
+		for gr, nameSet := range resourceNames {
+			group, resource := splitGroupResource(gr)
+			desiredRole.Rules = append(desiredRole.Rules, rbacv1.PolicyRule{
+				APIGroups:     []string{group},
+				Resources:     []string{resource},
+				Verbs:         verbs,
+				ResourceNames: nameSet.UnsortedList(),
+			})
+		}
+		desiredRole.Rules = normalizeRules(desiredRole.Rules)
+	}
+
+	clusterRoleList := rbacv1.ClusterRoleList{}
+	err := c.crClient.List(ctx, &clusterRoleList, listOption)
+	if err != nil {
+		c.log.Error(err, "error listing ClusterRoles")
+		return err
+	}
+	var existingRole *rbacv1.ClusterRole
+	clusterRolesToDelete := []rbacv1.ClusterRole{}
+	for i, cr := range clusterRoleList.Items {
+		if existingRole == nil && desiredRole != nil {
+			existingRole = &clusterRoleList.Items[i]
+		} else {
+			clusterRolesToDelete = append(clusterRolesToDelete, cr)
+		}
+	}
+
+	if desiredRole != nil {
+		if existingRole != nil {
+			desiredRole.Name = existingRole.Name
+			desiredRole.GenerateName = ""
+			if clusterRoleNeedsUpdate(existingRole, desiredRole) {
+				updatedRole := existingRole.DeepCopy()
+				updatedRole.Rules = desiredRole.Rules
+				updatedRole.OwnerReferences = desiredRole.OwnerReferences
+				updatedRole.Labels = mergeLabels(updatedRole.Labels, desiredRole.Labels)
+				c.log.Info("Updating ClusterRole", "ClusterRole", updatedRole)
+				err := c.crClient.Update(ctx, updatedRole)
+				if err != nil {
+					c.log.Error(err, "error updating ClusterRole")
+					return err
+				}
+				rr.clusterRolesUpdated++
+			} else {
+				rr.clusterRolesUnchanged++
+			}
+		} else {
+			c.log.Info("Creating ClusterRole", "ClusterRole", desiredRole)
+			err := c.crClient.Create(ctx, desiredRole)
+			if err != nil {
+				c.log.Error(err, "error creating ClusterRole")
+				return err
+			}
+			rr.clusterRolesCreated++
+		}
+	}
+
+	for _, crtd := range clusterRolesToDelete {
+		c.log.Info("Deleting ClusterRole", "ClusterRole", crtd)
+		err := c.crClient.Delete(ctx, &crtd)
+		if err != nil {
+			c.log.Error(err, "error deleting ClusterRole")
+			return err
+		}
+		rr.clusterRolesDeleted++
+	}
+
+	clusterRoleBindingList := rbacv1.ClusterRoleBindingList{}
+	err = c.crClient.List(ctx, &clusterRoleBindingList, listOption)
+	if err != nil {
+		c.log.Error(err, "error listing ClusterRoleBindings")
+		return err
+	}
+	var existingBinding *rbacv1.ClusterRoleBinding
+	clusterRoleBindingsToDelete := []rbacv1.ClusterRoleBinding{}
+	for i, crb := range clusterRoleBindingList.Items {
+		// The RoleRef of an existing ClusterRoleBinding can't be changed.
+		if existingBinding == nil && desiredRole != nil && crb.RoleRef.Name == desiredRole.Name {
+			existingBinding = &clusterRoleBindingList.Items[i]
+		} else {
+			clusterRoleBindingsToDelete = append(clusterRoleBindingsToDelete, crb)
+		}
+	}
+
+	if desiredRole != nil {
+		crb := rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:          rbacLabels,
+				OwnerReferences: ownerRefs,
+			},
+			Subjects: subjects,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.SchemeGroupVersion.Group,
+				Kind:     "ClusterRole",
+				Name:     desiredRole.Name,
+			},
+		}
+		if existingBinding != nil {
+			if clusterRoleBindingNeedsUpdate(existingBinding, &crb) {
+				updatedCRB := existingBinding.DeepCopy()
+				updatedCRB.Subjects = crb.Subjects
+				updatedCRB.OwnerReferences = crb.OwnerReferences
+				updatedCRB.Labels = mergeLabels(updatedCRB.Labels, crb.Labels)
+				c.log.Info("Updating ClusterRoleBinding", "ClusterRoleBinding", updatedCRB)
+				err := c.crClient.Update(ctx, updatedCRB)
+				if err != nil {
+					c.log.Error(err, "error updating ClusterRoleBinding")
+					return err
+				}
+				rr.clusterRoleBindingsUpdated++
+			} else {
+				rr.clusterRoleBindingsUnchanged++
+			}
+		} else {
+			crb.GenerateName = fmt.Sprintf("%s-", crp.Name)
+			c.log.Info("Creating ClusterRoleBinding", "ClusterRoleBinding", crb)
+			err := c.crClient.Create(ctx, &crb)
+			if err != nil {
+				c.log.Error(err, "error creating ClusterRoleBinding")
+				return err
+			}
+			rr.clusterRoleBindingsCreated++
+		}
+	}
+
+	for _, crbtd := range clusterRoleBindingsToDelete {
+		c.log.Info("Deleting ClusterRoleBinding", "ClusterRoleBinding", crbtd)
+		err := c.crClient.Delete(ctx, &crbtd)
+		if err != nil {
+			c.log.Error(err, "error deleting ClusterRoleBinding")
+			return err
+		}
+		rr.clusterRoleBindingsDeleted++
+	}
+
+	return nil
+}
+
+// cleanupRBAC deletes all Roles, RoleBindings, ClusterRoles and
+// ClusterRoleBindings that were generated for the named
+// ClusterReferencePattern.
+func (c *Controller) cleanupRBAC(ctx context.Context, patternName string) error {
+	return c.deleteRBAC(ctx, patternName, nil)
+}
+
+// deleteRBAC deletes the Roles, RoleBindings, ClusterRoles and
+// ClusterRoleBindings that were generated for the named
+// ClusterReferencePattern, except for those of the consumers with the provided
+// UIDs.
+func (c *Controller) deleteRBAC(ctx context.Context, patternName string, keepConsumerUIDs sets.Set[string]) error {
+	listOption := client.MatchingLabels{labelKeyPatternName: patternName}
+	keep := func(obj client.Object) bool {
+		return keepConsumerUIDs.Has(obj.GetLabels()[labelKeyConsumerUID])
+	}
+	rolesDeleted, roleBindingsDeleted, clusterRolesDeleted, clusterRoleBindingsDeleted := 0, 0, 0, 0
+
+	roleList := rbacv1.RoleList{}
+	err := c.crClient.List(ctx, &roleList, listOption)
+	if err != nil {
+		c.log.Error(err, "error listing Roles")
+		return err
+	}
+	for _, role := range roleList.Items {
+		if keep(&role) {
+			continue
+		}
+		c.log.Info("Deleting role", "role", role)
+		err := c.crClient.Delete(ctx, &role)
+		if err != nil && !errors.IsNotFound(err) {
+			c.log.Error(err, "error deleting Role")
+			return err
+		}
+		rolesDeleted++
+	}
+
+	roleBindingList := rbacv1.RoleBindingList{}
+	err = c.crClient.List(ctx, &roleBindingList, listOption)
+	if err != nil {
+		c.log.Error(err, "error listing RoleBindings")
+		return err
+	}
+	for _, rb := range roleBindingList.Items {
+		if keep(&rb) {
+			continue
+		}
+		c.log.Info("Deleting RoleBinding", "RoleBinding", rb)
+		err := c.crClient.Delete(ctx, &rb)
+		if err != nil && !errors.IsNotFound(err) {
+			c.log.Error(err, "error deleting RoleBinding")
+			return err
+		}
+		roleBindingsDeleted++
+	}
+
+	clusterRoleList := rbacv1.ClusterRoleList{}
+	err = c.crClient.List(ctx, &clusterRoleList, listOption)
+	if err != nil {
+		c.log.Error(err, "error listing ClusterRoles")
+		return err
+	}
+	for _, cr := range clusterRoleList.Items {
+		if keep(&cr) {
+			continue
+		}
+		c.log.Info("Deleting ClusterRole", "ClusterRole", cr)
+		err := c.crClient.Delete(ctx, &cr)
+		if err != nil && !errors.IsNotFound(err) {
+			c.log.Error(err, "error deleting ClusterRole")
+			return err
+		}
+		clusterRolesDeleted++
+	}
+
+	clusterRoleBindingList := rbacv1.ClusterRoleBindingList{}
+	err = c.crClient.List(ctx, &clusterRoleBindingList, listOption)
+	if err != nil {
+		c.log.Error(err, "error listing ClusterRoleBindings")
+		return err
+	}
+	for _, crb := range clusterRoleBindingList.Items {
+		if keep(&crb) {
+			continue
+		}
+		c.log.Info("Deleting ClusterRoleBinding", "ClusterRoleBinding", crb)
+		err := c.crClient.Delete(ctx, &crb)
+		if err != nil && !errors.IsNotFound(err) {
+			c.log.Error(err, "error deleting ClusterRoleBinding")
+			return err
+		}
+		clusterRoleBindingsDeleted++
+	}
+
+	c.log.Info("Completed RBAC cleanup", "pattern", patternName, "rolesDeleted", rolesDeleted, "roleBindingsDeleted", roleBindingsDeleted,
+		"clusterRolesDeleted", clusterRolesDeleted, "clusterRoleBindingsDeleted", clusterRoleBindingsDeleted)
 
 	return nil
 }
@@ -0,0 +1,463 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestController returns a Controller backed by a fake client holding the
+// objects and a fake discovery serving secrets, configmaps and namespaces.
+func newTestController(objs ...client.Object) *Controller {
+	dc := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*metav1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "secrets", Kind: "Secret", Namespaced: true},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false},
+			},
+		}},
+	}}
+
+	return &Controller{
+		crClient: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build(),
+		kinds:    newKindMapper(dc),
+		programs: newProgramCache(),
+		log:      logr.Discard(),
+	}
+}
+
+func TestBaselineAllows(t *testing.T) {
+	sameNamespace := reference{Resource: "secrets", FromNamespace: "infra", ToNamespace: "infra", Name: "cert"}
+	crossNamespace := reference{Resource: "secrets", FromNamespace: "infra", ToNamespace: "apps", Name: "cert"}
+	clusterScoped := reference{Resource: "namespaces", FromNamespace: "infra", Name: "apps"}
+
+	tests := []struct {
+		name     string
+		baseline v1a1.BaselineGrantType
+		ref      reference
+		want     bool
+	}{
+		{name: "all allows cross-namespace", baseline: v1a1.BaselineGrantAll, ref: crossNamespace, want: true},
+		{name: "all allows cluster-scoped", baseline: v1a1.BaselineGrantAll, ref: clusterScoped, want: true},
+		{name: "same namespace allows same namespace", baseline: v1a1.BaselineGrantSameNamespace, ref: sameNamespace, want: true},
+		{name: "same namespace denies cross-namespace", baseline: v1a1.BaselineGrantSameNamespace, ref: crossNamespace, want: false},
+		{name: "same namespace denies cluster-scoped", baseline: v1a1.BaselineGrantSameNamespace, ref: clusterScoped, want: false},
+		{name: "none denies same namespace", baseline: v1a1.BaselineGrantNone, ref: sameNamespace, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := baselineAllows(tc.baseline, &tc.ref); got != tc.want {
+				t.Errorf("baselineAllows() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGrantAllows(t *testing.T) {
+	ref := reference{
+		Group:         "",
+		Resource:      "secrets",
+		FromNamespace: "infra",
+		FromName:      "gw",
+		ToNamespace:   "apps",
+		Name:          "cert-apps",
+	}
+	clusterRef := ref
+	clusterRef.FromNamespace = ""
+
+	prodSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+
+	tests := []struct {
+		name           string
+		from           []v1a1.ReferenceGrantFrom
+		to             []v1a1.ReferenceGrantTo
+		ref            reference
+		fromLabels     labels.Set
+		referrerLabels labels.Set
+		want           bool
+	}{{
+		name: "namespace without to",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		ref:  ref,
+		want: true,
+	}, {
+		name: "other namespace",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "other"}},
+		ref:  ref,
+		want: false,
+	}, {
+		name: "second from matches",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "other"}, {Namespace: "infra"}},
+		ref:  ref,
+		want: true,
+	}, {
+		name: "referrer name",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra", Name: "gw"}},
+		ref:  ref,
+		want: true,
+	}, {
+		name: "other referrer name",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra", Name: "other"}},
+		ref:  ref,
+		want: false,
+	}, {
+		name:           "referrer selector",
+		from:           []v1a1.ReferenceGrantFrom{{Namespace: "infra", Selector: prodSelector}},
+		ref:            ref,
+		referrerLabels: labels.Set{"env": "prod"},
+		want:           true,
+	}, {
+		name:           "referrer selector does not match",
+		from:           []v1a1.ReferenceGrantFrom{{Namespace: "infra", Selector: prodSelector}},
+		ref:            ref,
+		referrerLabels: labels.Set{"env": "dev"},
+		want:           false,
+	}, {
+		name:       "namespace selector",
+		from:       []v1a1.ReferenceGrantFrom{{NamespaceSelector: prodSelector}},
+		ref:        ref,
+		fromLabels: labels.Set{"env": "prod"},
+		want:       true,
+	}, {
+		name:       "namespace selector does not match",
+		from:       []v1a1.ReferenceGrantFrom{{NamespaceSelector: prodSelector}},
+		ref:        ref,
+		fromLabels: labels.Set{"env": "dev"},
+		want:       false,
+	}, {
+		name: "namespace selector without namespace labels",
+		from: []v1a1.ReferenceGrantFrom{{NamespaceSelector: &metav1.LabelSelector{}}},
+		ref:  ref,
+		want: false,
+	}, {
+		name: "cluster-scoped referrer",
+		from: []v1a1.ReferenceGrantFrom{{ClusterScoped: true}},
+		ref:  clusterRef,
+		want: true,
+	}, {
+		name: "cluster-scoped referrer needs to be trusted explicitly",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}, {NamespaceSelector: &metav1.LabelSelector{}}},
+		ref:  clusterRef,
+		want: false,
+	}, {
+		name: "cluster-scoped trust does not apply to namespaced referrers",
+		from: []v1a1.ReferenceGrantFrom{{ClusterScoped: true}},
+		ref:  ref,
+		want: false,
+	}, {
+		name: "to resource",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		to:   []v1a1.ReferenceGrantTo{{Group: "", Resource: "secrets"}},
+		ref:  ref,
+		want: true,
+	}, {
+		name: "to other resource",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		to:   []v1a1.ReferenceGrantTo{{Group: "", Resource: "configmaps"}},
+		ref:  ref,
+		want: false,
+	}, {
+		name: "to name",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		to:   []v1a1.ReferenceGrantTo{{Group: "", Resource: "secrets", Name: "cert-apps"}},
+		ref:  ref,
+		want: true,
+	}, {
+		name: "to other name",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		to:   []v1a1.ReferenceGrantTo{{Group: "", Resource: "secrets", Name: "cert-other"}},
+		ref:  ref,
+		want: false,
+	}, {
+		name: "to name prefix",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		to:   []v1a1.ReferenceGrantTo{{Group: "", Resource: "secrets", NamePrefix: "cert-"}},
+		ref:  ref,
+		want: true,
+	}, {
+		name: "to other name prefix",
+		from: []v1a1.ReferenceGrantFrom{{Namespace: "infra"}},
+		to:   []v1a1.ReferenceGrantTo{{Group: "", Resource: "secrets", NamePrefix: "key-"}},
+		ref:  ref,
+		want: false,
+	}}
+
+	c := newTestController()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rg := &v1a1.ReferenceGrant{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "grant"},
+				From:       tc.from,
+				To:         tc.to,
+			}
+			if got := c.grantAllows(rg, &tc.ref, tc.fromLabels, tc.referrerLabels); got != tc.want {
+				t.Errorf("grantAllows() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetGrants(t *testing.T) {
+	crp := &v1a1.ClusterReferencePattern{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-secrets", Labels: map[string]string{"kind": "tls"}},
+	}
+	namespaces := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"env": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: map[string]string{"env": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "c", Labels: map[string]string{"env": "dev"}}},
+	}
+	prod := metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+
+	tests := []struct {
+		name string
+		rgs  []v1a1.ReferenceGrant
+		crgs []v1a1.ClusterReferenceGrant
+		want map[string][]string
+	}{{
+		name: "reference grants by pattern name and selector",
+		rgs: []v1a1.ReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "by-name"}, PatternNames: []string{"gateway-secrets"}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "by-selector"}, PatternSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kind": "tls"}}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "other-pattern"}, PatternNames: []string{"other"}},
+		},
+		want: map[string][]string{"a": {"by-name", "by-selector"}},
+	}, {
+		name: "cluster grant expanded into selected namespaces",
+		crgs: []v1a1.ClusterReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prod"}, PatternNames: []string{"gateway-secrets"}, TargetNamespaceSelector: prod},
+		},
+		want: map[string][]string{"a": {"prod"}, "b": {"prod"}},
+	}, {
+		name: "reference grant takes precedence over cluster grant",
+		rgs: []v1a1.ReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "owner"}, PatternNames: []string{"gateway-secrets"}},
+		},
+		crgs: []v1a1.ClusterReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prod"}, PatternNames: []string{"gateway-secrets"}, TargetNamespaceSelector: prod},
+		},
+		want: map[string][]string{"a": {"owner"}, "b": {"prod"}},
+	}, {
+		name: "reference grant for other pattern does not take precedence",
+		rgs: []v1a1.ReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "owner"}, PatternNames: []string{"other"}},
+		},
+		crgs: []v1a1.ClusterReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prod"}, PatternNames: []string{"gateway-secrets"}, TargetNamespaceSelector: prod},
+		},
+		want: map[string][]string{"a": {"prod"}, "b": {"prod"}},
+	}, {
+		name: "cluster grant for other pattern",
+		crgs: []v1a1.ClusterReferenceGrant{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prod"}, PatternNames: []string{"other"}, TargetNamespaceSelector: prod},
+		},
+		want: map[string][]string{},
+	}}
+
+	c := newTestController(namespaces...)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			grants := c.getGrants(context.Background(), crp,
+				&v1a1.ReferenceGrantList{Items: tc.rgs},
+				&v1a1.ClusterReferenceGrantList{Items: tc.crgs})
+
+			got := map[string][]string{}
+			for ns, rgs := range grants {
+				for _, rg := range rgs {
+					got[ns] = append(got[ns], rg.Name)
+				}
+				sort.Strings(got[ns])
+			}
+			if !apiequality.Semantic.DeepEqual(tc.want, got) {
+				t.Errorf("getGrants() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetPathReferences(t *testing.T) {
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"namespace": "infra", "name": "gw"},
+	}}
+	clusterGateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "ClusterGateway",
+		"metadata":   map[string]interface{}{"name": "gw"},
+	}}
+
+	secret := func(namespace, name string) reference {
+		return reference{Group: "", Resource: "secrets", FromNamespace: "infra", FromName: "gw", ToNamespace: namespace, Name: name}
+	}
+
+	tests := []struct {
+		name           string
+		item           *unstructured.Unstructured
+		refs           []interface{}
+		path           v1a1.ReferencePath
+		want           []reference
+		wantMalformed  []string
+		wantUnresolved int
+	}{{
+		name: "kind defaults to referrer namespace",
+		item: gateway,
+		refs: []interface{}{map[string]interface{}{"group": "", "kind": "Secret", "name": "cert"}},
+		path: v1a1.ReferencePath{Path: ".spec.refs[*]"},
+		want: []reference{secret("infra", "cert")},
+	}, {
+		name: "resource and namespace",
+		item: gateway,
+		refs: []interface{}{map[string]interface{}{"group": "", "resource": "secrets", "namespace": "apps", "name": "cert"}},
+		path: v1a1.ReferencePath{Path: ".spec.refs[*]"},
+		want: []reference{secret("apps", "cert")},
+	}, {
+		name: "path to list",
+		item: gateway,
+		refs: []interface{}{
+			map[string]interface{}{"group": "", "kind": "Secret", "name": "a"},
+			map[string]interface{}{"group": "", "kind": "Secret", "name": "b"},
+			map[string]interface{}{"group": "", "kind": "Secret", "name": "a"},
+		},
+		path: v1a1.ReferencePath{Path: ".spec.refs"},
+		want: []reference{secret("infra", "a"), secret("infra", "b")},
+	}, {
+		name: "cluster-scoped target",
+		item: gateway,
+		refs: []interface{}{map[string]interface{}{"group": "", "kind": "Namespace", "namespace": "ignored", "name": "apps"}},
+		path: v1a1.ReferencePath{Path: ".spec.refs[*]"},
+		want: []reference{{Group: "", Resource: "namespaces", FromNamespace: "infra", FromName: "gw", Name: "apps"}},
+	}, {
+		name: "targets filter references",
+		item: gateway,
+		refs: []interface{}{
+			map[string]interface{}{"group": "", "kind": "Secret", "name": "cert"},
+			map[string]interface{}{"group": "", "kind": "ConfigMap", "name": "config"},
+		},
+		path: v1a1.ReferencePath{Path: ".spec.refs[*]", Targets: []v1a1.ReferenceTarget{{Group: "", Resource: "secrets"}}},
+		want: []reference{secret("infra", "cert")},
+	}, {
+		name:           "unknown kind",
+		item:           gateway,
+		refs:           []interface{}{map[string]interface{}{"group": "example.com", "kind": "Unknown", "name": "x"}},
+		path:           v1a1.ReferencePath{Path: ".spec.refs[*]"},
+		want:           []reference{},
+		wantUnresolved: 1,
+	}, {
+		name: "malformed references",
+		item: gateway,
+		refs: []interface{}{
+			map[string]interface{}{"kind": "Secret", "name": "no-group"},
+			map[string]interface{}{"group": "", "name": "no-kind"},
+			map[string]interface{}{"group": "", "kind": "Secret"},
+			map[string]interface{}{"group": "", "kind": "Secret", "name": int64(1)},
+			map[string]interface{}{"group": "", "kind": "Secret", "namespace": "", "name": "empty-namespace"},
+			"cert",
+		},
+		path: v1a1.ReferencePath{Path: ".spec.refs[*]"},
+		want: []reference{},
+		wantMalformed: []string{
+			"reference is missing group",
+			"reference is missing kind or resource",
+			"reference is missing name",
+			`field "name" of reference must be a string`,
+			"reference to a namespaced resource is missing namespace",
+			"expected a reference object but found string",
+		},
+	}, {
+		name: "cluster-scoped referrer without namespace",
+		item: clusterGateway,
+		refs: []interface{}{
+			map[string]interface{}{"group": "", "kind": "Secret", "namespace": "apps", "name": "cert"},
+			map[string]interface{}{"group": "", "kind": "Secret", "name": "cert"},
+		},
+		path:          v1a1.ReferencePath{Path: ".spec.refs[*]"},
+		want:          []reference{{Group: "", Resource: "secrets", FromName: "gw", ToNamespace: "apps", Name: "cert"}},
+		wantMalformed: []string{"reference to a namespaced resource is missing namespace"},
+	}, {
+		name: "expression",
+		item: gateway,
+		refs: []interface{}{
+			map[string]interface{}{"certificateRefs": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}}},
+			map[string]interface{}{"certificateRefs": []interface{}{map[string]interface{}{"name": "c", "namespace": "apps"}}},
+		},
+		path: v1a1.ReferencePath{Expression: "object.spec.refs.map(l, l.certificateRefs.map(r, {'group': '', 'kind': 'Secret', 'namespace': 'namespace' in r ? r['namespace'] : object.metadata['namespace'], 'name': r.name}))"},
+		want: []reference{secret("infra", "a"), secret("infra", "b"), secret("apps", "c")},
+	}, {
+		name:          "expression error",
+		item:          gateway,
+		refs:          []interface{}{},
+		path:          v1a1.ReferencePath{Expression: "object.spec.missing"},
+		want:          []reference{},
+		wantMalformed: []string{"no such key: missing"},
+	}}
+
+	c := newTestController()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			crp := &v1a1.ClusterReferencePattern{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Paths:      []v1a1.ReferencePath{tc.path},
+			}
+			paths, err := c.parsePaths(crp)
+			if err != nil {
+				t.Fatalf("parsePaths failed: %v", err)
+			}
+			defer c.programs.release(crp.Name)
+
+			item := tc.item.DeepCopy()
+			item.Object["spec"] = map[string]interface{}{"refs": tc.refs}
+			found := newFoundReferences()
+			c.getPathReferences(item, &paths[0], found)
+
+			if !apiequality.Semantic.DeepEqual(tc.want, found.refs) {
+				t.Errorf("references = %+v, want %+v", found.refs, tc.want)
+			}
+			malformed := []string{}
+			for _, mr := range found.malformed {
+				malformed = append(malformed, mr.Message)
+			}
+			if len(tc.wantMalformed) == 0 {
+				tc.wantMalformed = []string{}
+			}
+			if !apiequality.Semantic.DeepEqual(tc.wantMalformed, malformed) {
+				t.Errorf("malformed references = %q, want %q", malformed, tc.wantMalformed)
+			}
+			if len(found.unresolved) != tc.wantUnresolved {
+				t.Errorf("got %d unresolved references, want %d", len(found.unresolved), tc.wantUnresolved)
+			}
+		})
+	}
+}
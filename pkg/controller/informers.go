@@ -0,0 +1,368 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// informerRetryInterval is how long a pattern waits before checking again
+	// on informers that have not synced. Informers notify their patterns once
+	// they sync, so this mostly matters for informers that failed to list.
+	informerRetryInterval = 30 * time.Second
+)
+
+// errInformerNotSynced is returned while an informer has not listed its
+// resource yet.
+var errInformerNotSynced = errors.New("informer has not synced")
+
+func isNotSynced(err error) bool {
+	return errors.Is(err, errInformerNotSynced)
+}
+
+// informerRegistry manages shared informers keyed by resource. Informers are
+// started lazily when the first ClusterReferencePattern needs a resource and
+// stopped when the last one is released. Relevant changes to an object result
+// in a GenericEvent for every pattern using its resource.
+type informerRegistry[K comparable] struct {
+	// kind names the role of the resources in log messages.
+	kind        string
+	newInformer func(gvr schema.GroupVersionResource) cache.SharedIndexInformer
+	// changed reports whether an update is relevant to the patterns.
+	changed func(oldObj, newObj interface{}) bool
+	events  chan<- event.GenericEvent
+	log     logr.Logger
+
+	mu        sync.Mutex
+	informers map[K]*sharedInformer
+	// patternKeys tracks the resources each pattern is using.
+	patternKeys map[string]sets.Set[K]
+}
+
+type sharedInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+	patterns sets.Set[string]
+	// listErr is the last error listing the resource before the informer
+	// synced.
+	listErr error
+}
+
+func newInformerRegistry[K comparable](kind string, newInformer func(schema.GroupVersionResource) cache.SharedIndexInformer, changed func(oldObj, newObj interface{}) bool, events chan<- event.GenericEvent, log logr.Logger) *informerRegistry[K] {
+	return &informerRegistry[K]{
+		kind:        kind,
+		newInformer: newInformer,
+		changed:     changed,
+		events:      events,
+		log:         log,
+		informers:   map[K]*sharedInformer{},
+		patternKeys: map[string]sets.Set[K]{},
+	}
+}
+
+// register makes the pattern a user of exactly the provided resources and
+// returns whether all their informers have synced, see checkSynced. Resources
+// the pattern no longer uses are released.
+func (r *informerRegistry[K]) register(patternName string, gvrs map[K]schema.GroupVersionResource) error {
+	r.mu.Lock()
+	desired := sets.New[K]()
+	for key, gvr := range gvrs {
+		desired.Insert(key)
+		inf, ok := r.informers[key]
+		if !ok {
+			inf = r.startLocked(key, gvr)
+		}
+		inf.patterns.Insert(patternName)
+	}
+	for key := range r.patternKeys[patternName].Difference(desired) {
+		r.releaseLocked(patternName, key)
+	}
+	if desired.Len() > 0 {
+		r.patternKeys[patternName] = desired
+	} else {
+		delete(r.patternKeys, patternName)
+	}
+	r.mu.Unlock()
+
+	return r.checkSynced(desired.UnsortedList())
+}
+
+// get returns the informer of the resource, if any pattern is using it.
+func (r *informerRegistry[K]) get(key K) (*sharedInformer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inf, ok := r.informers[key]
+	return inf, ok
+}
+
+// release removes the pattern as a user of all its resources, stopping the
+// informers no other pattern is using.
+func (r *informerRegistry[K]) release(patternName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.patternKeys[patternName] {
+		r.releaseLocked(patternName, key)
+	}
+	delete(r.patternKeys, patternName)
+}
+
+func (r *informerRegistry[K]) startLocked(key K, gvr schema.GroupVersionResource) *sharedInformer {
+	r.log.Info(fmt.Sprintf("Starting informer for %s resource", r.kind), "resource", gvr)
+
+	inf := &sharedInformer{
+		informer: r.newInformer(gvr),
+		stopCh:   make(chan struct{}),
+		patterns: sets.New[string](),
+	}
+	inf.informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			// The initial list is already covered by the reconcile that
+			// started this informer.
+			if !isInInitialList {
+				r.notify(key)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if r.changed(oldObj, newObj) {
+				r.notify(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			r.notify(key)
+		},
+	})
+	err := inf.informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		r.mu.Lock()
+		inf.listErr = err
+		r.mu.Unlock()
+	})
+	if err != nil {
+		r.log.Error(err, "could not set watch error handler", "resource", gvr)
+	}
+	r.informers[key] = inf
+	go inf.informer.Run(inf.stopCh)
+	// Patterns that found the informer not synced are not blocked on it, so
+	// trigger them once it has synced.
+	go func() {
+		if cache.WaitForCacheSync(inf.stopCh, inf.informer.HasSynced) {
+			r.notify(key)
+		}
+	}()
+
+	return inf
+}
+
+// checkSynced returns errInformerNotSynced if one of the informers is still
+// listing its resource. Informers that failed to list are stopped rather than
+// left retrying, the error is returned and the next registration of the
+// resource starts a new informer.
+func (r *informerRegistry[K]) checkSynced(keys []K) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var notSynced error
+	for _, key := range keys {
+		inf, ok := r.informers[key]
+		if !ok || inf.informer.HasSynced() {
+			continue
+		}
+		if inf.listErr != nil {
+			r.log.Info(fmt.Sprintf("Stopping informer for %s resource that failed to list", r.kind), "resource", key, "error", inf.listErr)
+			close(inf.stopCh)
+			delete(r.informers, key)
+			return fmt.Errorf("could not list %s resource %v: %w", r.kind, key, inf.listErr)
+		}
+		notSynced = fmt.Errorf("%s resource %v: %w", r.kind, key, errInformerNotSynced)
+	}
+
+	return notSynced
+}
+
+// notify sends an event for every pattern that uses the resource.
+func (r *informerRegistry[K]) notify(key K) {
+	r.mu.Lock()
+	var patternNames []string
+	if inf, ok := r.informers[key]; ok {
+		patternNames = inf.patterns.UnsortedList()
+	}
+	r.mu.Unlock()
+
+	for _, pn := range patternNames {
+		r.events <- event.GenericEvent{Object: &v1a1.ClusterReferencePattern{ObjectMeta: metav1.ObjectMeta{Name: pn}}}
+	}
+}
+
+func (r *informerRegistry[K]) releaseLocked(patternName string, key K) {
+	inf, ok := r.informers[key]
+	if !ok {
+		return
+	}
+	inf.patterns.Delete(patternName)
+	if inf.patterns.Len() == 0 {
+		r.log.Info(fmt.Sprintf("Stopping informer for %s resource", r.kind), "resource", key)
+		close(inf.stopCh)
+		delete(r.informers, key)
+	}
+}
+
+// referrerInformers manages one shared dynamic informer per referrer
+// resource. Any change to the labels or spec of a referrer triggers the
+// patterns using its resource.
+type referrerInformers struct {
+	*informerRegistry[schema.GroupVersionResource]
+}
+
+func newReferrerInformers(dClient dynamic.Interface, events chan<- event.GenericEvent, log logr.Logger) *referrerInformers {
+	newInformer := func(gvr schema.GroupVersionResource) cache.SharedIndexInformer {
+		return dynamicinformer.NewFilteredDynamicInformer(dClient, gvr, "", 0, cache.Indexers{}, nil).Informer()
+	}
+	changed := func(oldObj, newObj interface{}) bool {
+		oldU, oldOk := oldObj.(*unstructured.Unstructured)
+		newU, newOk := newObj.(*unstructured.Unstructured)
+		return !oldOk || !newOk || referrerChanged(oldU, newU)
+	}
+	return &referrerInformers{newInformerRegistry[schema.GroupVersionResource]("referrer", newInformer, changed, events, log)}
+}
+
+// list registers the pattern as the user of the referrer resource and returns
+// all cached objects of that resource. If the pattern previously used a
+// different resource, that registration is released. The returned error wraps
+// errInformerNotSynced while the resource is still being listed.
+func (ri *referrerInformers) list(patternName string, gvr schema.GroupVersionResource) ([]*unstructured.Unstructured, error) {
+	err := ri.register(patternName, map[schema.GroupVersionResource]schema.GroupVersionResource{gvr: gvr})
+	if err != nil {
+		return nil, err
+	}
+	inf, ok := ri.get(gvr)
+	if !ok {
+		return nil, fmt.Errorf("referrer resource %v: %w", gvr, errInformerNotSynced)
+	}
+
+	objs := inf.informer.GetStore().List()
+	items := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		items = append(items, u)
+	}
+
+	return items, nil
+}
+
+// referrerChanged reports whether an update to a referrer may change the
+// references it holds or the grants that select it. Only the labels and the
+// spec matter; status-only updates are ignored. Resources that do not track a
+// generation have their content compared directly.
+func referrerChanged(oldU, newU *unstructured.Unstructured) bool {
+	if !labels.Equals(oldU.GetLabels(), newU.GetLabels()) {
+		return true
+	}
+	if oldU.GetGeneration() != 0 || newU.GetGeneration() != 0 {
+		return oldU.GetGeneration() != newU.GetGeneration()
+	}
+	return !equality.Semantic.DeepEqual(referrerContent(oldU), referrerContent(newU))
+}
+
+// referrerContent returns the object without its metadata and status.
+func referrerContent(u *unstructured.Unstructured) map[string]interface{} {
+	content := make(map[string]interface{}, len(u.Object))
+	for k, v := range u.Object {
+		if k != "metadata" && k != "status" {
+			content[k] = v
+		}
+	}
+	return content
+}
+
+// targetInformers manages one shared metadata informer per target resource
+// that ReferenceGrants select by labels. Label changes on a target trigger the
+// patterns using its resource.
+type targetInformers struct {
+	*informerRegistry[schema.GroupResource]
+}
+
+func newTargetInformers(mClient metadata.Interface, events chan<- event.GenericEvent, log logr.Logger) *targetInformers {
+	newInformer := func(gvr schema.GroupVersionResource) cache.SharedIndexInformer {
+		return metadatainformer.NewFilteredMetadataInformer(mClient, gvr, "", 0, cache.Indexers{}, nil).Informer()
+	}
+	changed := func(oldObj, newObj interface{}) bool {
+		// Only labels are relevant to grants.
+		oldM, oldOk := oldObj.(*metav1.PartialObjectMetadata)
+		newM, newOk := newObj.(*metav1.PartialObjectMetadata)
+		return !oldOk || !newOk || !labels.Equals(oldM.Labels, newM.Labels)
+	}
+	return &targetInformers{newInformerRegistry[schema.GroupResource]("target", newInformer, changed, events, log)}
+}
+
+// ensure registers the pattern as a user of exactly the provided target
+// resources and returns whether their informers have synced, see
+// checkSynced. Resources the pattern no longer uses are released.
+func (ti *targetInformers) ensure(patternName string, gvrs []schema.GroupVersionResource) error {
+	byResource := make(map[schema.GroupResource]schema.GroupVersionResource, len(gvrs))
+	for _, gvr := range gvrs {
+		byResource[gvr.GroupResource()] = gvr
+	}
+	return ti.register(patternName, byResource)
+}
+
+// labels returns the labels of the target, and false if the target is not
+// known.
+func (ti *targetInformers) labels(gr schema.GroupResource, namespace, name string) (map[string]string, bool) {
+	inf, ok := ti.get(gr)
+	if !ok {
+		return nil, false
+	}
+
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	obj, exists, err := inf.informer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return nil, false
+	}
+	m, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return nil, false
+	}
+
+	return m.Labels, true
+}
@@ -16,6 +16,56 @@ limitations under the License.
 
 package main
 
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// knownVerbs are the verbs a ClusterReferencePattern can request.
+var knownVerbs = sets.New(
+	string(v1a1.ReferenceVerbGet),
+	string(v1a1.ReferenceVerbList),
+	string(v1a1.ReferenceVerbWatch),
+	string(v1a1.ReferenceVerbUpdate),
+	string(v1a1.ReferenceVerbPatch),
+)
+
 func main() {
-	NewController()
+	opts := Options{}
+	flag.BoolVar(&opts.EnableWebhooks, "enable-webhooks", false, "Serve the validating admission and conversion webhooks.")
+	flag.StringVar(&opts.WebhookCertDir, "webhook-cert-dir", "", "Directory containing tls.crt and tls.key for the webhook server.")
+	allowedVerbs := flag.String("allowed-verbs", "get,list,watch", "Comma-separated verbs ClusterReferencePatterns may grant on referenced resources. Patterns requesting other verbs are not accepted.")
+	flag.Parse()
+
+	verbs, err := parseVerbs(*allowedVerbs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --allowed-verbs: %v\n", err)
+		os.Exit(2)
+	}
+	opts.AllowedVerbs = verbs
+
+	NewController(opts)
+}
+
+// parseVerbs splits a comma-separated list of verbs, ignoring whitespace and
+// empty entries.
+func parseVerbs(s string) ([]string, error) {
+	var verbs []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !knownVerbs.Has(v) {
+			return nil, fmt.Errorf("unknown verb %q, must be one of %s", v, strings.Join(sets.List(knownVerbs), ", "))
+		}
+		verbs = append(verbs, v)
+	}
+	return verbs, nil
 }
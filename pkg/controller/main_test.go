@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestParseVerbs(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", s: "get,list,watch", want: []string{"get", "list", "watch"}},
+		{name: "whitespace and empty entries", s: " get, ,list ,", want: []string{"get", "list"}},
+		{name: "empty", s: "", want: nil},
+		{name: "unknown verb", s: "get,read", wantErr: true},
+		{name: "case sensitive", s: "GET", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseVerbs(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseVerbs() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !apiequality.Semantic.DeepEqual(tc.want, got) {
+				t.Errorf("parseVerbs() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
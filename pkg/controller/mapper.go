@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	// kindMapperResetInterval limits how often a miss invalidates the
+	// discovery cache, so that references to a kind that does not exist do
+	// not result in a full discovery on every reconcile.
+	kindMapperResetInterval = 30 * time.Second
+)
+
+// kindMapper resolves the kinds found in references to resources and looks up
+// the scope of referenced resources. It is backed
+// by a discovery cache that is invalidated when a kind can not be found, so
+// kinds of CRDs installed after the controller started are picked up.
+type kindMapper struct {
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+
+	mu        sync.Mutex
+	lastReset time.Time
+}
+
+func newKindMapper(client discovery.DiscoveryInterface) *kindMapper {
+	return &kindMapper{
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client)),
+	}
+}
+
+// resourceFor returns the resource for the kind in its preferred version and
+// whether it is cluster-scoped.
+func (km *kindMapper) resourceFor(gk schema.GroupKind) (string, bool, error) {
+	mapping, err := km.mapper.RESTMapping(gk)
+	if meta.IsNoMatchError(err) && km.shouldReset() {
+		km.mapper.Reset()
+		mapping, err = km.mapper.RESTMapping(gk)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return mapping.Resource.Resource, mapping.Scope.Name() == meta.RESTScopeNameRoot, nil
+}
+
+// isClusterScoped returns true if the resource is cluster-scoped.
+func (km *kindMapper) isClusterScoped(gr schema.GroupResource) (bool, error) {
+	gvr := gr.WithVersion("")
+	gvk, err := km.mapper.KindFor(gvr)
+	if meta.IsNoMatchError(err) && km.shouldReset() {
+		km.mapper.Reset()
+		gvk, err = km.mapper.KindFor(gvr)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, clusterScoped, err := km.resourceFor(gvk.GroupKind())
+	return clusterScoped, err
+}
+
+// versionedResourceFor returns the resource in its preferred version.
+func (km *kindMapper) versionedResourceFor(gr schema.GroupResource) (schema.GroupVersionResource, error) {
+	gvr, err := km.mapper.ResourceFor(gr.WithVersion(""))
+	if meta.IsNoMatchError(err) && km.shouldReset() {
+		km.mapper.Reset()
+		gvr, err = km.mapper.ResourceFor(gr.WithVersion(""))
+	}
+	return gvr, err
+}
+
+func (km *kindMapper) shouldReset() bool {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	if time.Since(km.lastReset) < kindMapperResetInterval {
+		return false
+	}
+	km.lastReset = time.Now()
+	return true
+}
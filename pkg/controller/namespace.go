@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NamespaceHandler queues the patterns of ReferenceGrants and
+// ClusterReferenceGrants with a namespace selector when a namespace they
+// select is created, deleted or relabeled.
+type NamespaceHandler struct {
+	c *Controller
+}
+
+func NewNamespaceHandler(c *Controller) *NamespaceHandler {
+	return &NamespaceHandler{c: c}
+}
+
+func (h *NamespaceHandler) Create(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForNamespace(ctx, q, e.Object.GetLabels())
+}
+
+func (h *NamespaceHandler) Update(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	if labels.Equals(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+		return
+	}
+	h.queuePatternsForNamespace(ctx, q, e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+}
+
+func (h *NamespaceHandler) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForNamespace(ctx, q, e.Object.GetLabels())
+}
+
+func (h *NamespaceHandler) Generic(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.queuePatternsForNamespace(ctx, q, e.Object.GetLabels())
+}
+
+// queuePatternsForNamespace queues the patterns of every grant with a
+// namespace selector matching any of the label sets.
+func (h *NamespaceHandler) queuePatternsForNamespace(ctx context.Context, q workqueue.RateLimitingInterface, labelSets ...map[string]string) {
+	rgList := &v1a1.ReferenceGrantList{}
+	err := h.c.crClient.List(ctx, rgList)
+	if err != nil {
+		h.c.log.Error(err, "error listing ReferenceGrants")
+		return
+	}
+
+	crgList := &v1a1.ClusterReferenceGrantList{}
+	err = h.c.crClient.List(ctx, crgList)
+	if err != nil {
+		h.c.log.Error(err, "error listing ClusterReferenceGrants")
+		return
+	}
+
+	patternNames := sets.New[string]()
+	for _, rg := range rgList.Items {
+		if !fromSelectsAny(rg.From, labelSets) {
+			continue
+		}
+		names, err := h.c.grantPatternNames(ctx, &rg)
+		if err != nil {
+			h.c.log.Error(err, "error finding ClusterReferencePatterns of ReferenceGrant", "namespace", rg.Namespace, "name", rg.Name)
+		}
+		patternNames = patternNames.Union(names)
+	}
+
+	// Namespaces selected as targets of a ClusterReferenceGrant change which
+	// references it allows just like the trusted ones.
+	for _, crg := range crgList.Items {
+		if !fromSelectsAny(crg.From, labelSets) && !selectsAny(&crg.TargetNamespaceSelector, labelSets) {
+			continue
+		}
+		names, err := h.c.grantPatternNames(ctx, clusterGrantView(&crg))
+		if err != nil {
+			h.c.log.Error(err, "error finding ClusterReferencePatterns of ClusterReferenceGrant", "name", crg.Name)
+		}
+		patternNames = patternNames.Union(names)
+	}
+
+	for pn := range patternNames {
+		q.AddRateLimited(reconcile.Request{NamespacedName: types.NamespacedName{Name: pn}})
+	}
+}
+
+// fromSelectsAny returns true if the namespace selector of any of the
+// ReferenceGrantFroms matches any of the label sets.
+func fromSelectsAny(from []v1a1.ReferenceGrantFrom, labelSets []map[string]string) bool {
+	for _, f := range from {
+		if f.NamespaceSelector != nil && selectsAny(f.NamespaceSelector, labelSets) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsAny returns true if the label selector matches any of the label sets.
+// Invalid selectors match nothing.
+func selectsAny(ls *metav1.LabelSelector, labelSets []map[string]string) bool {
+	selector, err := metav1.LabelSelectorAsSelector(ls)
+	if err != nil {
+		return false
+	}
+	for _, set := range labelSets {
+		if selector.Matches(labels.Set(set)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ManagedRBACHandler handles events for the RBAC resources generated by this
+// controller, queueing the pattern they were generated for so that any drift
+// is reverted.
+type ManagedRBACHandler struct {
+	c *Controller
+}
+
+func NewManagedRBACHandler(c *Controller) *ManagedRBACHandler {
+	return &ManagedRBACHandler{c: c}
+}
+
+func (h *ManagedRBACHandler) Create(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	queuePatternForRBAC(e.Object, q)
+}
+
+func (h *ManagedRBACHandler) Update(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	queuePatternForRBAC(e.ObjectNew, q)
+	queuePatternForRBAC(e.ObjectOld, q)
+}
+
+func (h *ManagedRBACHandler) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	queuePatternForRBAC(e.Object, q)
+}
+
+func (h *ManagedRBACHandler) Generic(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	queuePatternForRBAC(e.Object, q)
+}
+
+func queuePatternForRBAC(obj client.Object, q workqueue.RateLimitingInterface) {
+	pn, ok := obj.GetLabels()[labelKeyPatternName]
+	if !ok || pn == "" {
+		return
+	}
+	q.AddRateLimited(reconcile.Request{NamespacedName: types.NamespacedName{Name: pn}})
+}
+
+// normalizeRules returns a sorted copy of the rules, with every list within
+// each rule sorted as well, so that semantically equal rules compare equal.
+func normalizeRules(rules []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	normalized := make([]rbacv1.PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		r := *rule.DeepCopy()
+		sort.Strings(r.APIGroups)
+		sort.Strings(r.Resources)
+		sort.Strings(r.Verbs)
+		sort.Strings(r.ResourceNames)
+		sort.Strings(r.NonResourceURLs)
+		normalized = append(normalized, r)
+	}
+	sort.SliceStable(normalized, func(i, j int) bool {
+		return ruleKey(&normalized[i]) < ruleKey(&normalized[j])
+	})
+	return normalized
+}
+
+func ruleKey(r *rbacv1.PolicyRule) string {
+	return strings.Join([]string{
+		strings.Join(r.APIGroups, ","),
+		strings.Join(r.Resources, ","),
+		strings.Join(r.ResourceNames, ","),
+		strings.Join(r.Verbs, ","),
+		strings.Join(r.NonResourceURLs, ","),
+	}, "/")
+}
+
+// normalizeSubjects returns a sorted copy of the subjects without duplicates.
+// The API group of User and Group subjects is defaulted like the API server
+// does, so that stored subjects compare equal.
+func normalizeSubjects(subjects []rbacv1.Subject) []rbacv1.Subject {
+	seen := map[rbacv1.Subject]bool{}
+	normalized := make([]rbacv1.Subject, 0, len(subjects))
+	for _, s := range subjects {
+		if s.APIGroup == "" && (s.Kind == rbacv1.UserKind || s.Kind == rbacv1.GroupKind) {
+			s.APIGroup = rbacv1.GroupName
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		normalized = append(normalized, s)
+	}
+	sort.Slice(normalized, func(i, j int) bool {
+		a, b := normalized[i], normalized[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.APIGroup < b.APIGroup
+	})
+	return normalized
+}
+
+// roleNeedsUpdate returns true if the existing Role differs semantically from
+// the desired one.
+func roleNeedsUpdate(existing, desired *rbacv1.Role) bool {
+	return !equality.Semantic.DeepEqual(normalizeRules(existing.Rules), desired.Rules) ||
+		!equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) ||
+		!hasLabels(existing.Labels, desired.Labels)
+}
+
+// roleBindingNeedsUpdate returns true if the existing RoleBinding differs
+// semantically from the desired one. The RoleRef is immutable and is expected
+// to already match.
+func roleBindingNeedsUpdate(existing, desired *rbacv1.RoleBinding) bool {
+	return !equality.Semantic.DeepEqual(normalizeSubjects(existing.Subjects), desired.Subjects) ||
+		!equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) ||
+		!hasLabels(existing.Labels, desired.Labels)
+}
+
+// clusterRoleNeedsUpdate returns true if the existing ClusterRole differs
+// semantically from the desired one.
+func clusterRoleNeedsUpdate(existing, desired *rbacv1.ClusterRole) bool {
+	return !equality.Semantic.DeepEqual(normalizeRules(existing.Rules), desired.Rules) ||
+		!equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) ||
+		!hasLabels(existing.Labels, desired.Labels)
+}
+
+// clusterRoleBindingNeedsUpdate returns true if the existing
+// ClusterRoleBinding differs semantically from the desired one. The RoleRef is
+// immutable and is expected to already match.
+func clusterRoleBindingNeedsUpdate(existing, desired *rbacv1.ClusterRoleBinding) bool {
+	return !equality.Semantic.DeepEqual(normalizeSubjects(existing.Subjects), desired.Subjects) ||
+		!equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) ||
+		!hasLabels(existing.Labels, desired.Labels)
+}
+
+// hasLabels returns true if all the desired labels are set on the existing
+// object. Additional labels are left alone.
+func hasLabels(existing, desired map[string]string) bool {
+	for k, v := range desired {
+		if existing[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLabels returns a copy of the existing labels with the desired labels
+// set.
+func mergeLabels(existing, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(existing)+len(desired))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNormalizeRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []rbacv1.PolicyRule
+		want  []rbacv1.PolicyRule
+	}{{
+		name:  "empty",
+		rules: nil,
+		want:  []rbacv1.PolicyRule{},
+	}, {
+		name: "lists within rules are sorted",
+		rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			Verbs:         []string{"watch", "get", "list"},
+			ResourceNames: []string{"b", "a"},
+		}},
+		want: []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			Verbs:         []string{"get", "list", "watch"},
+			ResourceNames: []string{"a", "b"},
+		}},
+	}, {
+		name: "rules are sorted",
+		rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+		},
+		want: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeRules(tc.rules); !apiequality.Semantic.DeepEqual(tc.want, got) {
+				t.Errorf("normalizeRules() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeSubjects(t *testing.T) {
+	sa := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "gateway-system", Name: "controller"}
+	user := rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "alice"}
+	group := rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "admins"}
+
+	tests := []struct {
+		name     string
+		subjects []rbacv1.Subject
+		want     []rbacv1.Subject
+	}{{
+		name:     "sorted by kind",
+		subjects: []rbacv1.Subject{user, sa, group},
+		want:     []rbacv1.Subject{group, sa, user},
+	}, {
+		name:     "duplicates are dropped",
+		subjects: []rbacv1.Subject{sa, sa},
+		want:     []rbacv1.Subject{sa},
+	}, {
+		name: "API group of users and groups is defaulted",
+		subjects: []rbacv1.Subject{
+			{Kind: rbacv1.UserKind, Name: "alice"},
+			{Kind: rbacv1.GroupKind, Name: "admins"},
+			user,
+		},
+		want: []rbacv1.Subject{group, user},
+	}, {
+		name:     "API group of service accounts is left empty",
+		subjects: []rbacv1.Subject{sa},
+		want:     []rbacv1.Subject{sa},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeSubjects(tc.subjects); !apiequality.Semantic.DeepEqual(tc.want, got) {
+				t.Errorf("normalizeSubjects() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRoleNeedsUpdate(t *testing.T) {
+	desired := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:          map[string]string{labelKeyPatternName: "gateway-secrets"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ClusterReferenceConsumer", Name: "gateway-controller", UID: "1"}},
+		},
+		Rules: normalizeRules([]rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			Verbs:         []string{"get", "list", "watch"},
+			ResourceNames: []string{"a", "b"},
+		}}),
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*rbacv1.Role)
+		want   bool
+	}{{
+		name:   "equal",
+		mutate: func(*rbacv1.Role) {},
+		want:   false,
+	}, {
+		name: "rules in other order",
+		mutate: func(r *rbacv1.Role) {
+			r.Rules[0].Verbs = []string{"watch", "list", "get"}
+			r.Rules[0].ResourceNames = []string{"b", "a"}
+		},
+		want: false,
+	}, {
+		name:   "additional labels",
+		mutate: func(r *rbacv1.Role) { r.Labels["example.com/team"] = "infra" },
+		want:   false,
+	}, {
+		name:   "rules differ",
+		mutate: func(r *rbacv1.Role) { r.Rules[0].ResourceNames = []string{"a"} },
+		want:   true,
+	}, {
+		name:   "label missing",
+		mutate: func(r *rbacv1.Role) { delete(r.Labels, labelKeyPatternName) },
+		want:   true,
+	}, {
+		name:   "owner differs",
+		mutate: func(r *rbacv1.Role) { r.OwnerReferences = nil },
+		want:   true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := desired.DeepCopy()
+			tc.mutate(existing)
+			if got := roleNeedsUpdate(existing, desired); got != tc.want {
+				t.Errorf("roleNeedsUpdate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRoleBindingNeedsUpdate(t *testing.T) {
+	desired := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{labelKeyPatternName: "gateway-secrets"},
+		},
+		Subjects: normalizeSubjects([]rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}}),
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*rbacv1.RoleBinding)
+		want   bool
+	}{{
+		name:   "equal",
+		mutate: func(*rbacv1.RoleBinding) {},
+		want:   false,
+	}, {
+		name: "API group defaulted by the API server",
+		mutate: func(rb *rbacv1.RoleBinding) {
+			rb.Subjects = []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "alice"}}
+		},
+		want: false,
+	}, {
+		name: "subjects differ",
+		mutate: func(rb *rbacv1.RoleBinding) {
+			rb.Subjects = []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "bob"}}
+		},
+		want: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := desired.DeepCopy()
+			tc.mutate(existing)
+			if got := roleBindingNeedsUpdate(existing, desired); got != tc.want {
+				t.Errorf("roleBindingNeedsUpdate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -36,23 +36,31 @@ func NewReferenceGrantHandler(c *Controller) *ReferenceGrantHandler {
 }
 
 func (h *ReferenceGrantHandler) Create(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
-	queuePatternForRG(e.Object, q)
+	h.queuePatternsForRG(ctx, e.Object, q)
 }
 
+// Update queues the patterns of both the old and the new grant, so that
+// patterns the grant no longer applies to drop what it allowed.
 func (h *ReferenceGrantHandler) Update(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
-	queuePatternForRG(e.ObjectNew, q)
-	queuePatternForRG(e.ObjectOld, q)
+	h.queuePatternsForRG(ctx, e.ObjectNew, q)
+	h.queuePatternsForRG(ctx, e.ObjectOld, q)
 }
 
 func (h *ReferenceGrantHandler) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
-	queuePatternForRG(e.Object, q)
+	h.queuePatternsForRG(ctx, e.Object, q)
 }
 
 func (h *ReferenceGrantHandler) Generic(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
-	queuePatternForRG(e.Object, q)
+	h.queuePatternsForRG(ctx, e.Object, q)
 }
 
-func queuePatternForRG(obj client.Object, q workqueue.RateLimitingInterface) {
+func (h *ReferenceGrantHandler) queuePatternsForRG(ctx context.Context, obj client.Object, q workqueue.RateLimitingInterface) {
 	rg := obj.(*v1a1.ReferenceGrant)
-	q.AddRateLimited(reconcile.Request{NamespacedName: types.NamespacedName{Name: rg.PatternName}})
+	patternNames, err := h.c.grantPatternNames(ctx, rg)
+	if err != nil {
+		h.c.log.Error(err, "error finding ClusterReferencePatterns of ReferenceGrant", "namespace", rg.Namespace, "name", rg.Name)
+	}
+	for pn := range patternNames {
+		q.AddRateLimited(reconcile.Request{NamespacedName: types.NamespacedName{Name: pn}})
+	}
 }
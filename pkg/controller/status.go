@@ -0,0 +1,494 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// maxStatusEntries limits the length of lists in status, it must match the
+// MaxItems validation of those lists.
+const maxStatusEntries = 32
+
+// maxStatusMessageLength limits the length of messages in status list
+// entries, it must match their MaxLength validation.
+const maxStatusMessageLength = 1024
+
+// setCondition adds or updates a condition, the transition time is only
+// changed when the status of the condition changes.
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// updatePatternStatus writes the status of the ClusterReferencePattern if it
+// changed.
+func (c *Controller) updatePatternStatus(ctx context.Context, crp *v1a1.ClusterReferencePattern, status *v1a1.ClusterReferencePatternStatus) error {
+	if equality.Semantic.DeepEqual(crp.Status, *status) {
+		return nil
+	}
+
+	crp.Status = *status
+	err := c.crClient.Status().Update(ctx, crp)
+	if err != nil {
+		c.log.Error(err, "error updating ClusterReferencePattern status", "name", crp.Name)
+		return err
+	}
+
+	return nil
+}
+
+// updateConsumerStatuses updates the status of every ClusterReferenceConsumer
+// that implements the named pattern. The pattern is nil if it does not exist,
+// otherwise it is used instead of the cached copy since its status may have
+// just been updated.
+func (c *Controller) updateConsumerStatuses(ctx context.Context, patternName string, crp *v1a1.ClusterReferencePattern, list *v1a1.ClusterReferenceConsumerList) error {
+	crpList := &v1a1.ClusterReferencePatternList{}
+	err := c.crClient.List(ctx, crpList)
+	if err != nil {
+		c.log.Error(err, "could not list ClusterReferencePatterns")
+		return err
+	}
+
+	patterns := map[string]*v1a1.ClusterReferencePattern{}
+	for i := range crpList.Items {
+		patterns[crpList.Items[i].Name] = &crpList.Items[i]
+	}
+	delete(patterns, patternName)
+	if crp != nil {
+		patterns[patternName] = crp
+	}
+
+	for _, crc := range list.Items {
+		if !consumerImplements(&crc, patternName) {
+			continue
+		}
+
+		status := crc.Status.DeepCopy()
+		status.ObservedGeneration = crc.Generation
+		setCondition(&status.Conditions, crc.Generation, v1a1.ConditionAccepted, metav1.ConditionTrue, v1a1.ReasonAccepted, "")
+
+		missing := []string{}
+		notProgrammed := []string{}
+		for _, pn := range crc.PatternNames {
+			p, ok := patterns[pn]
+			if !ok {
+				missing = append(missing, pn)
+				continue
+			}
+			if !meta.IsStatusConditionTrue(p.Status.Conditions, v1a1.ConditionProgrammed) {
+				notProgrammed = append(notProgrammed, pn)
+			}
+		}
+
+		if len(missing) > 0 {
+			msg := fmt.Sprintf("ClusterReferencePatterns not found: %s", strings.Join(missing, ", "))
+			setCondition(&status.Conditions, crc.Generation, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonPatternNotFound, msg)
+		} else {
+			setCondition(&status.Conditions, crc.Generation, v1a1.ConditionResolvedRefs, metav1.ConditionTrue, v1a1.ReasonResolvedRefs, "")
+		}
+
+		if len(missing) > 0 || len(notProgrammed) > 0 {
+			msg := fmt.Sprintf("ClusterReferencePatterns not programmed: %s", strings.Join(append(missing, notProgrammed...), ", "))
+			setCondition(&status.Conditions, crc.Generation, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, msg)
+		} else {
+			setCondition(&status.Conditions, crc.Generation, v1a1.ConditionProgrammed, metav1.ConditionTrue, v1a1.ReasonProgrammed, "")
+		}
+
+		if equality.Semantic.DeepEqual(crc.Status, *status) {
+			continue
+		}
+		crc.Status = *status
+		err := c.crClient.Status().Update(ctx, &crc)
+		if err != nil {
+			c.log.Error(err, "error updating ClusterReferenceConsumer status", "name", crc.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateGrantStatuses updates the status of every ReferenceGrant and
+// ClusterReferenceGrant for the named pattern, as well as of grants that still
+// report usage by it. The pattern is nil if it does not exist. The results are
+// nil if references could not be evaluated, in which case the previously
+// reported references are left as they are.
+func (c *Controller) updateGrantStatuses(ctx context.Context, patternName string, crp *v1a1.ClusterReferencePattern, list *v1a1.ReferenceGrantList, clusterList *v1a1.ClusterReferenceGrantList, results *authorizationResults) error {
+	crpList := &v1a1.ClusterReferencePatternList{}
+	err := c.crClient.List(ctx, crpList)
+	if err != nil {
+		c.log.Error(err, "could not list ClusterReferencePatterns")
+		return err
+	}
+
+	patterns := map[string]*v1a1.ClusterReferencePattern{}
+	for i := range crpList.Items {
+		patterns[crpList.Items[i].Name] = &crpList.Items[i]
+	}
+	delete(patterns, patternName)
+	if crp != nil {
+		patterns[patternName] = crp
+	}
+
+	for _, rg := range list.Items {
+		status := rg.Status.DeepCopy()
+		if !setGrantStatus(status, &rg, patternName, crp, patterns, results) {
+			continue
+		}
+
+		if equality.Semantic.DeepEqual(rg.Status, *status) {
+			continue
+		}
+		rg.Status = *status
+		err := c.crClient.Status().Update(ctx, &rg)
+		if err != nil {
+			c.log.Error(err, "error updating ReferenceGrant status", "namespace", rg.Namespace, "name", rg.Name)
+			return err
+		}
+	}
+
+	for _, crg := range clusterList.Items {
+		status := crg.Status.DeepCopy()
+		if !setGrantStatus(status, clusterGrantView(&crg), patternName, crp, patterns, results) {
+			continue
+		}
+
+		if equality.Semantic.DeepEqual(crg.Status, *status) {
+			continue
+		}
+		crg.Status = *status
+		err := c.crClient.Status().Update(ctx, &crg)
+		if err != nil {
+			c.log.Error(err, "error updating ClusterReferenceGrant status", "name", crg.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setGrantStatus updates the status of a grant for the named pattern. It
+// returns false if the grant neither applies to the pattern nor reports usage
+// by it, in which case the status is left alone. Grants without a namespace
+// are ClusterReferenceGrants, which do not report denied references.
+func setGrantStatus(status *v1a1.ReferenceGrantStatus, rg *v1a1.ReferenceGrant, patternName string, crp *v1a1.ClusterReferencePattern, patterns map[string]*v1a1.ClusterReferencePattern, results *authorizationResults) bool {
+	applies := grantAppliesTo(rg, patternName, crp)
+	if !applies && !hasGrantPatternStatus(status, patternName) {
+		return false
+	}
+
+	status.ObservedGeneration = rg.Generation
+	setCondition(&status.Conditions, rg.Generation, v1a1.ConditionAccepted, metav1.ConditionTrue, v1a1.ReasonAccepted, "")
+	setGrantConditions(status, rg, patterns)
+
+	if !applies || crp == nil {
+		setGrantPatternUsage(status, patternName, nil, nil)
+	} else if results != nil {
+		usage := results.grants[types.NamespacedName{Namespace: rg.Namespace, Name: rg.Name}]
+		denied := 0
+		if rg.Namespace != "" {
+			denied = len(results.denied[rg.Namespace])
+		}
+		setGrantUsage(status, crp, usage, denied)
+	}
+
+	return true
+}
+
+// setGrantConditions sets the conditions of a ReferenceGrant from the state
+// of all patterns it applies to.
+func setGrantConditions(status *v1a1.ReferenceGrantStatus, rg *v1a1.ReferenceGrant, patterns map[string]*v1a1.ClusterReferencePattern) {
+	missing := []string{}
+	matched := []*v1a1.ClusterReferencePattern{}
+	if rg.PatternSelector != nil {
+		for _, p := range patterns {
+			if grantAppliesTo(rg, p.Name, p) {
+				matched = append(matched, p)
+			}
+		}
+	} else {
+		names := rg.PatternNames
+		if rg.PatternName != "" {
+			names = []string{rg.PatternName}
+		}
+		for _, pn := range names {
+			p, ok := patterns[pn]
+			if !ok {
+				missing = append(missing, pn)
+				continue
+			}
+			matched = append(matched, p)
+		}
+	}
+
+	notProgrammed := []string{}
+	for _, p := range matched {
+		if !meta.IsStatusConditionTrue(p.Status.Conditions, v1a1.ConditionProgrammed) {
+			notProgrammed = append(notProgrammed, p.Name)
+		}
+	}
+	sort.Strings(notProgrammed)
+
+	switch {
+	case len(missing) > 0:
+		msg := fmt.Sprintf("ClusterReferencePatterns not found: %s", strings.Join(missing, ", "))
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonPatternNotFound, msg)
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, msg)
+	case len(matched) == 0:
+		msg := "No ClusterReferencePattern matches the pattern selector"
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionResolvedRefs, metav1.ConditionFalse, v1a1.ReasonPatternNotFound, msg)
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, msg)
+	case len(notProgrammed) > 0:
+		msg := fmt.Sprintf("ClusterReferencePatterns not programmed: %s", strings.Join(notProgrammed, ", "))
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionResolvedRefs, metav1.ConditionTrue, v1a1.ReasonResolvedRefs, "")
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionProgrammed, metav1.ConditionFalse, v1a1.ReasonPending, msg)
+	default:
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionResolvedRefs, metav1.ConditionTrue, v1a1.ReasonResolvedRefs, "")
+		setCondition(&status.Conditions, rg.Generation, v1a1.ConditionProgrammed, metav1.ConditionTrue, v1a1.ReasonProgrammed, "")
+	}
+}
+
+// hasGrantPatternStatus returns true if the status reports usage by the named
+// pattern.
+func hasGrantPatternStatus(status *v1a1.ReferenceGrantStatus, patternName string) bool {
+	for _, ps := range status.Patterns {
+		if ps.Name == patternName {
+			return true
+		}
+	}
+	return false
+}
+
+// setGrantUsage records the references a ReferenceGrant authorized for the
+// pattern in its status. Lists are sorted and truncated to keep the object
+// small.
+func setGrantUsage(status *v1a1.ReferenceGrantStatus, crp *v1a1.ClusterReferencePattern, usage *grantUsage, denied int) {
+	entry := &v1a1.ReferenceGrantPatternStatus{
+		Name:                 crp.Name,
+		DeniedReferenceCount: int32(denied),
+	}
+	if usage == nil {
+		setGrantPatternUsage(status, crp.Name, entry, nil)
+		return
+	}
+
+	var authorized []v1a1.AuthorizedReference
+	for ref := range usage.refs {
+		authorized = append(authorized, v1a1.AuthorizedReference{
+			Pattern: crp.Name,
+			Referrer: v1a1.ReferrerRef{
+				Group:     crp.Group,
+				Resource:  crp.Resource,
+				Namespace: ref.FromNamespace,
+				Name:      ref.FromName,
+			},
+			Group:    ref.Group,
+			Resource: ref.Resource,
+			Name:     ref.Name,
+		})
+	}
+	entry.AuthorizedReferenceCount = int32(len(authorized))
+
+	consumers := sets.List(usage.consumers)
+	if len(consumers) > maxStatusEntries {
+		consumers = consumers[:maxStatusEntries]
+	}
+	entry.Consumers = consumers
+
+	setGrantPatternUsage(status, crp.Name, entry, authorized)
+}
+
+// setGrantPatternUsage replaces the usage recorded for the named pattern and
+// recomputes the totals across all patterns. A nil entry removes the usage of
+// the pattern.
+func setGrantPatternUsage(status *v1a1.ReferenceGrantStatus, patternName string, entry *v1a1.ReferenceGrantPatternStatus, refs []v1a1.AuthorizedReference) {
+	var patterns []v1a1.ReferenceGrantPatternStatus
+	for _, ps := range status.Patterns {
+		if ps.Name != patternName {
+			patterns = append(patterns, ps)
+		}
+	}
+	if entry != nil {
+		patterns = append(patterns, *entry)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].Name < patterns[j].Name
+	})
+	if len(patterns) > maxStatusEntries {
+		patterns = patterns[:maxStatusEntries]
+	}
+
+	// References of patterns that are no longer reported, including ones
+	// recorded before usage was broken down by pattern, are dropped.
+	reported := sets.New[string]()
+	for _, ps := range patterns {
+		reported.Insert(ps.Name)
+	}
+	var authorized []v1a1.AuthorizedReference
+	for _, ar := range status.AuthorizedReferences {
+		if ar.Pattern != patternName && reported.Has(ar.Pattern) {
+			authorized = append(authorized, ar)
+		}
+	}
+	if entry != nil {
+		authorized = append(authorized, refs...)
+	}
+	sort.Slice(authorized, func(i, j int) bool {
+		a, b := authorized[i], authorized[j]
+		if a.Pattern != b.Pattern {
+			return a.Pattern < b.Pattern
+		}
+		if a.Referrer.Namespace != b.Referrer.Namespace {
+			return a.Referrer.Namespace < b.Referrer.Namespace
+		}
+		if a.Referrer.Name != b.Referrer.Name {
+			return a.Referrer.Name < b.Referrer.Name
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Name < b.Name
+	})
+	if len(authorized) > maxStatusEntries {
+		authorized = authorized[:maxStatusEntries]
+	}
+
+	consumers := sets.New[string]()
+	status.AuthorizedReferenceCount = 0
+	status.DeniedReferenceCount = 0
+	for _, ps := range patterns {
+		status.AuthorizedReferenceCount += ps.AuthorizedReferenceCount
+		status.DeniedReferenceCount += ps.DeniedReferenceCount
+		consumers.Insert(ps.Consumers...)
+	}
+	status.Patterns = patterns
+	status.AuthorizedReferences = authorized
+	status.Consumers = nil
+	if consumers.Len() > 0 {
+		status.Consumers = sets.List(consumers)
+		if len(status.Consumers) > maxStatusEntries {
+			status.Consumers = status.Consumers[:maxStatusEntries]
+		}
+	}
+}
+
+// setUnresolvedReferences records the references of the pattern whose kind
+// could not be resolved. The list is sorted and truncated to keep the object
+// small.
+func setUnresolvedReferences(status *v1a1.ClusterReferencePatternStatus, crp *v1a1.ClusterReferencePattern, unresolved []unresolvedReference) {
+	sort.Slice(unresolved, func(i, j int) bool {
+		a, b := unresolved[i], unresolved[j]
+		if a.FromNamespace != b.FromNamespace {
+			return a.FromNamespace < b.FromNamespace
+		}
+		if a.FromName != b.FromName {
+			return a.FromName < b.FromName
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+
+	status.UnresolvedReferences = nil
+	status.UnresolvedReferenceCount = int32(len(unresolved))
+	for _, ur := range unresolved {
+		if len(status.UnresolvedReferences) >= maxStatusEntries {
+			break
+		}
+		msg := ur.Message
+		if len(msg) > maxStatusMessageLength {
+			msg = msg[:maxStatusMessageLength]
+		}
+		status.UnresolvedReferences = append(status.UnresolvedReferences, v1a1.UnresolvedReference{
+			Referrer: v1a1.ReferrerRef{
+				Group:     crp.Group,
+				Resource:  crp.Resource,
+				Namespace: ur.FromNamespace,
+				Name:      ur.FromName,
+			},
+			Group:   ur.Group,
+			Kind:    ur.Kind,
+			Name:    ur.Name,
+			Message: msg,
+		})
+	}
+}
+
+// setMalformedReferences records the matches of the pattern's paths that are
+// not valid references. The list is sorted and truncated to keep the object
+// small.
+func setMalformedReferences(status *v1a1.ClusterReferencePatternStatus, crp *v1a1.ClusterReferencePattern, malformed []malformedReference) {
+	sort.Slice(malformed, func(i, j int) bool {
+		a, b := malformed[i], malformed[j]
+		if a.FromNamespace != b.FromNamespace {
+			return a.FromNamespace < b.FromNamespace
+		}
+		if a.FromName != b.FromName {
+			return a.FromName < b.FromName
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Message < b.Message
+	})
+
+	status.MalformedReferences = nil
+	status.MalformedReferenceCount = int32(len(malformed))
+	for _, mr := range malformed {
+		if len(status.MalformedReferences) >= maxStatusEntries {
+			break
+		}
+		msg := mr.Message
+		if len(msg) > maxStatusMessageLength {
+			msg = msg[:maxStatusMessageLength]
+		}
+		status.MalformedReferences = append(status.MalformedReferences, v1a1.MalformedReference{
+			Referrer: v1a1.ReferrerRef{
+				Group:     crp.Group,
+				Resource:  crp.Resource,
+				Namespace: mr.FromNamespace,
+				Name:      mr.FromName,
+			},
+			Path:    mr.Path,
+			Message: msg,
+		})
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/validate-reference-authorization-k8s-io-v1alpha1-clusterreferencepattern,mutating=false,failurePolicy=fail,sideEffects=None,groups=reference.authorization.k8s.io,resources=clusterreferencepatterns,verbs=create;update,versions=v1alpha1,name=vclusterreferencepattern.reference.authorization.k8s.io,admissionReviewVersions=v1
+
+// ClusterReferencePatternValidator rejects ClusterReferencePatterns with a path
+// that can not be parsed, an expression that does not type-check, verbs the
+// controller does not allow or a referrer resource that is not served. Updates
+// that leave the spec unchanged are always allowed.
+type ClusterReferencePatternValidator struct {
+	c *Controller
+}
+
+func NewClusterReferencePatternValidator(c *Controller) *ClusterReferencePatternValidator {
+	return &ClusterReferencePatternValidator{c: c}
+}
+
+func (v *ClusterReferencePatternValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj)
+}
+
+func (v *ClusterReferencePatternValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	if specUnchanged(oldObj, newObj) {
+		return nil, nil
+	}
+	return nil, v.validate(ctx, newObj)
+}
+
+func (v *ClusterReferencePatternValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *ClusterReferencePatternValidator) validate(ctx context.Context, obj runtime.Object) error {
+	crp, ok := obj.(*v1a1.ClusterReferencePattern)
+	if !ok {
+		return fmt.Errorf("expected a ClusterReferencePattern but got %T", obj)
+	}
+
+	var errs field.ErrorList
+
+	if crp.Path != "" {
+		errs = append(errs, validatePath(field.NewPath("path"), crp.Path)...)
+	}
+	for i, p := range crp.Paths {
+		if p.Expression != "" {
+			errs = append(errs, validateExpression(field.NewPath("paths").Index(i).Child("expression"), p.Expression)...)
+			continue
+		}
+		errs = append(errs, validatePath(field.NewPath("paths").Index(i).Child("path"), p.Path)...)
+	}
+
+	// Patterns without verbs grant the default verbs, which must not exceed
+	// the ceiling either.
+	if disallowed := v.c.disallowedVerbs(crp); len(disallowed) > 0 {
+		msg := fmt.Sprintf("verbs %s are not allowed by the controller, allowed verbs are %s", strings.Join(disallowed, ", "), strings.Join(sets.List(v.c.allowedVerbs), ", "))
+		if len(crp.Verbs) == 0 {
+			msg = "default " + msg
+		}
+		errs = append(errs, field.Invalid(field.NewPath("verbs"), crp.Verbs, msg))
+	}
+
+	if crp.Version == "" {
+		errs = append(errs, field.Required(field.NewPath("version"), "the version of the referrer resource is needed to list it"))
+	} else {
+		gvr := schema.GroupVersionResource{Group: crp.Group, Version: crp.Version, Resource: crp.Resource}
+		if _, err := v.c.mapper.KindFor(gvr); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("resource"), crp.Resource, fmt.Sprintf("%s is not served by the API server: %v", gvr, err)))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.NewInvalid(v1a1.SchemeGroupVersion.WithKind("ClusterReferencePattern").GroupKind(), crp.Name, errs)
+	}
+	return nil
+}
+
+// specUnchanged returns true if an update only changes metadata or status, or
+// if the object is being deleted. Such updates, like adding or removing the
+// finalizer, must not be rejected because something the spec depends on has
+// changed since it was validated.
+func specUnchanged(oldObj, newObj runtime.Object) bool {
+	if newMeta, ok := newObj.(metav1.Object); ok && newMeta.GetDeletionTimestamp() != nil {
+		return true
+	}
+	oldContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(oldObj)
+	if err != nil {
+		return false
+	}
+	newContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newObj)
+	if err != nil {
+		return false
+	}
+	for _, content := range []map[string]interface{}{oldContent, newContent} {
+		delete(content, "metadata")
+		delete(content, "status")
+	}
+	return equality.Semantic.DeepEqual(oldContent, newContent)
+}
+
+func validatePath(fldPath *field.Path, path string) field.ErrorList {
+	j := jsonpath.New("")
+	if err := j.Parse(fmt.Sprintf("{%s}", path)); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, path, err.Error())}
+	}
+	return nil
+}
+
+func validateExpression(fldPath *field.Path, expression string) field.ErrorList {
+	if _, err := compileExpression(expression); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, expression, err.Error())}
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-reference-authorization-k8s-io-v1alpha1-referencegrant,mutating=false,failurePolicy=fail,sideEffects=None,groups=reference.authorization.k8s.io,resources=referencegrants,verbs=create;update,versions=v1alpha1,name=vreferencegrant.reference.authorization.k8s.io,admissionReviewVersions=v1
+
+// ReferenceGrantValidator rejects ReferenceGrants for patterns that do not
+// exist or that allow references to resources the pattern can never produce.
+type ReferenceGrantValidator struct {
+	c *Controller
+}
+
+func NewReferenceGrantValidator(c *Controller) *ReferenceGrantValidator {
+	return &ReferenceGrantValidator{c: c}
+}
+
+func (v *ReferenceGrantValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj)
+}
+
+func (v *ReferenceGrantValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	if specUnchanged(oldObj, newObj) {
+		return nil, nil
+	}
+	return nil, v.validate(ctx, newObj)
+}
+
+func (v *ReferenceGrantValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *ReferenceGrantValidator) validate(ctx context.Context, obj runtime.Object) error {
+	rg, ok := obj.(*v1a1.ReferenceGrant)
+	if !ok {
+		return fmt.Errorf("expected a ReferenceGrant but got %T", obj)
+	}
+
+	errs, err := validateGrant(ctx, v.c, rg)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errors.NewInvalid(v1a1.SchemeGroupVersion.WithKind("ReferenceGrant").GroupKind(), rg.Name, errs)
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-reference-authorization-k8s-io-v1alpha1-clusterreferencegrant,mutating=false,failurePolicy=fail,sideEffects=None,groups=reference.authorization.k8s.io,resources=clusterreferencegrants,verbs=create;update,versions=v1alpha1,name=vclusterreferencegrant.reference.authorization.k8s.io,admissionReviewVersions=v1
+
+// ClusterReferenceGrantValidator applies the same rules as the
+// ReferenceGrantValidator and rejects invalid target namespace selectors.
+type ClusterReferenceGrantValidator struct {
+	c *Controller
+}
+
+func NewClusterReferenceGrantValidator(c *Controller) *ClusterReferenceGrantValidator {
+	return &ClusterReferenceGrantValidator{c: c}
+}
+
+func (v *ClusterReferenceGrantValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj)
+}
+
+func (v *ClusterReferenceGrantValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	if specUnchanged(oldObj, newObj) {
+		return nil, nil
+	}
+	return nil, v.validate(ctx, newObj)
+}
+
+func (v *ClusterReferenceGrantValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *ClusterReferenceGrantValidator) validate(ctx context.Context, obj runtime.Object) error {
+	crg, ok := obj.(*v1a1.ClusterReferenceGrant)
+	if !ok {
+		return fmt.Errorf("expected a ClusterReferenceGrant but got %T", obj)
+	}
+
+	errs, err := validateGrant(ctx, v.c, clusterGrantView(crg))
+	if err != nil {
+		return err
+	}
+	if _, err := metav1.LabelSelectorAsSelector(&crg.TargetNamespaceSelector); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("targetNamespaceSelector"), crg.TargetNamespaceSelector, err.Error()))
+	}
+	if len(errs) > 0 {
+		return errors.NewInvalid(v1a1.SchemeGroupVersion.WithKind("ClusterReferenceGrant").GroupKind(), crg.Name, errs)
+	}
+	return nil
+}
+
+// validateGrant validates the fields ReferenceGrants and
+// ClusterReferenceGrants have in common. The returned error is only set if
+// validation itself failed.
+func validateGrant(ctx context.Context, c *Controller, rg *v1a1.ReferenceGrant) (field.ErrorList, error) {
+	var errs field.ErrorList
+
+	// Patterns listed by name must exist, patterns selected by label may
+	// still be created later. Patterns are read from the API server since a
+	// pattern created just before the grant may not be in the cache yet.
+	patterns := []v1a1.ClusterReferencePattern{}
+	getPattern := func(fldPath *field.Path, name string) error {
+		crp := &v1a1.ClusterReferencePattern{}
+		err := c.apiReader.Get(ctx, client.ObjectKey{Name: name}, crp)
+		if errors.IsNotFound(err) {
+			errs = append(errs, field.NotFound(fldPath, name))
+			return nil
+		} else if err != nil {
+			return err
+		}
+		patterns = append(patterns, *crp)
+		return nil
+	}
+	if rg.PatternName != "" {
+		if err := getPattern(field.NewPath("patternName"), rg.PatternName); err != nil {
+			return nil, err
+		}
+	}
+	for i, pn := range rg.PatternNames {
+		if err := getPattern(field.NewPath("patternNames").Index(i), pn); err != nil {
+			return nil, err
+		}
+	}
+	if rg.PatternSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(rg.PatternSelector)
+		if err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("patternSelector"), rg.PatternSelector, err.Error()))
+		} else {
+			crpList := &v1a1.ClusterReferencePatternList{}
+			err = c.apiReader.List(ctx, crpList, client.MatchingLabelsSelector{Selector: selector})
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, crpList.Items...)
+		}
+	}
+
+	for i, from := range rg.From {
+		if from.NamespaceSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(from.NamespaceSelector); err != nil {
+				errs = append(errs, field.Invalid(field.NewPath("from").Index(i).Child("namespaceSelector"), from.NamespaceSelector, err.Error()))
+			}
+		}
+		if from.Selector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(from.Selector); err != nil {
+				errs = append(errs, field.Invalid(field.NewPath("from").Index(i).Child("selector"), from.Selector, err.Error()))
+			}
+		}
+	}
+
+	for i, to := range rg.To {
+		if to.Selector == nil {
+			continue
+		}
+		if _, err := metav1.LabelSelectorAsSelector(to.Selector); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("to").Index(i).Child("selector"), to.Selector, err.Error()))
+		}
+	}
+
+	// References can only ever point to resources that are served and that
+	// one of the patterns allows as targets, anything else would be a grant
+	// that never matches.
+	targets := sets.New[schema.GroupResource]()
+	restricted := len(patterns) > 0
+	patternNames := []string{}
+	for i := range patterns {
+		t, r := patternTargets(&patterns[i])
+		targets = targets.Union(t)
+		restricted = restricted && r
+		patternNames = append(patternNames, patterns[i].Name)
+	}
+	for i, to := range rg.To {
+		gvr := schema.GroupVersionResource{Group: to.Group, Resource: to.Resource}
+		if _, err := c.mapper.KindFor(gvr); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("to").Index(i).Child("resource"), to.Resource, fmt.Sprintf("%s is not served by the API server", gvr.GroupResource())))
+			continue
+		}
+		if restricted && !targets.Has(gvr.GroupResource()) {
+			errs = append(errs, field.Invalid(field.NewPath("to").Index(i).Child("resource"), to.Resource, fmt.Sprintf("%s is not a target of ClusterReferencePatterns %s", gvr.GroupResource(), strings.Join(patternNames, ", "))))
+		}
+	}
+
+	return errs, nil
+}
+
+// patternTargets returns the resources references of the pattern may point to.
+// The second return value is false if any path of the pattern allows all
+// resources.
+func patternTargets(crp *v1a1.ClusterReferencePattern) (sets.Set[schema.GroupResource], bool) {
+	targets := sets.New[schema.GroupResource]()
+	paths := patternPaths(crp)
+	if len(paths) == 0 {
+		return targets, false
+	}
+	for _, p := range paths {
+		if len(p.Targets) == 0 {
+			return targets, false
+		}
+		for _, t := range p.Targets {
+			targets.Insert(schema.GroupResource{Group: t.Group, Resource: t.Resource})
+		}
+	}
+	return targets, true
+}
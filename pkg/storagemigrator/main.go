@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// storagemigrator rewrites every referencegrant-poc object in the current
+// storage version and then drops older versions from the CRDs' storedVersions.
+// Run it after upgrading to a release that changes the storage version and
+// before removing the previous version from the CRDs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	v1a1 "sigs.k8s.io/referencegrant-poc/apis/v1alpha1"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2/textlogger"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+var resources = []string{"clusterreferencepatterns", "clusterreferenceconsumers", "referencegrants", "clusterreferencegrants"}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "List the objects that would be migrated without writing them.")
+	flag.Parse()
+
+	log := textlogger.NewLogger(textlogger.NewConfig())
+	ctx := context.Background()
+
+	dClient, err := dynamic.NewForConfig(ctrl.GetConfigOrDie())
+	if err != nil {
+		log.Error(err, "could not create Dynamic client")
+		os.Exit(1)
+	}
+
+	for _, resource := range resources {
+		gr := schema.GroupResource{Group: v1a1.GroupName, Resource: resource}
+		gvr, err := storageVersion(ctx, dClient, gr)
+		if err != nil {
+			log.Error(err, "could not get storage version", "resource", gr)
+			os.Exit(1)
+		}
+		if err := migrate(ctx, log, dClient, gvr, *dryRun); err != nil {
+			log.Error(err, "could not migrate objects", "resource", gvr)
+			os.Exit(1)
+		}
+		if *dryRun {
+			continue
+		}
+		if err := updateStoredVersions(ctx, dClient, gvr); err != nil {
+			log.Error(err, "could not update stored versions", "resource", gvr)
+			os.Exit(1)
+		}
+	}
+}
+
+// storageVersion returns the resource in the version the CRD stores it in.
+func storageVersion(ctx context.Context, dClient dynamic.Interface, gr schema.GroupResource) (schema.GroupVersionResource, error) {
+	crd, err := dClient.Resource(crdGVR).Get(ctx, gr.String(), metav1.GetOptions{})
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if storage, _, _ := unstructured.NestedBool(version, "storage"); storage {
+			name, _, _ := unstructured.NestedString(version, "name")
+			return gr.WithVersion(name), nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("CustomResourceDefinition %s has no storage version", gr)
+}
+
+// migrate writes every object of the resource back unchanged. The API server
+// persists each write in the current storage version.
+func migrate(ctx context.Context, log logr.Logger, dClient dynamic.Interface, gvr schema.GroupVersionResource, dryRun bool) error {
+	list, err := dClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var invalid int
+	for _, item := range list.Items {
+		log.Info("Migrating object", "resource", gvr, "namespace", item.GetNamespace(), "name", item.GetName())
+		if dryRun {
+			continue
+		}
+
+		ri := dClient.Resource(gvr).Namespace(item.GetNamespace())
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			obj, err := ri.Get(ctx, item.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			_, err = ri.Update(ctx, obj, metav1.UpdateOptions{})
+			return err
+		})
+		if apierrors.IsInvalid(err) {
+			// Objects the storage version rejects, like v1alpha1
+			// ClusterReferencePatterns without version, need to be fixed
+			// by hand. Keep migrating the others.
+			log.Error(err, "could not migrate object", "resource", gvr, "namespace", item.GetNamespace(), "name", item.GetName())
+			invalid++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d objects are not valid in version %s", invalid, gvr.Version)
+	}
+	return nil
+}
+
+// updateStoredVersions records that all objects of the resource are now
+// stored in the storage version.
+func updateStoredVersions(ctx context.Context, dClient dynamic.Interface, gvr schema.GroupVersionResource) error {
+	name := gvr.GroupResource().String()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd, err := dClient.Resource(crdGVR).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedStringSlice(crd.Object, []string{gvr.Version}, "status", "storedVersions"); err != nil {
+			return err
+		}
+		_, err = dClient.Resource(crdGVR).UpdateStatus(ctx, crd, metav1.UpdateOptions{})
+		return err
+	})
+}